@@ -21,132 +21,552 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
 )
 
-func getGitlabLintURL(gitRepoPath string) (string, error) {
-	// If a gitlab URL was given as parameter, just use it
+// Returns the Gitlab lint API URL to use, and the Gitlab project it targets
+func getGitlabLintURL(gitRepoPath string) (string, string, error) {
+	// If a gitlab URL was given as parameter, just use it, with the project of the git remote if not given
 	if gitlabRootURL != "" {
-		return gitlabRootURL, nil
+		lintURL, project, _, err := gitlabProjectLintURL(gitlabRootURL, gitRemoteProjectPath(gitRepoPath, gitlabRootURL))
+		return lintURL, project, err
 	}
 
 	// Else, let's try to guess it, it there is a git repository
 	if gitRepoPath == "" {
 		// Warn user that we're defaulting because no git repo was found
 		yellow := color.New(color.FgYellow).SprintFunc()
-		fmt.Fprintf(color.Output, yellow("No GIT repository found, using default Gitlab API '%s'\n"), defaultGitlabRootURL)
+		fmt.Fprintf(messageOutput, yellow("No GIT repository found, using default Gitlab API '%s'\n"), defaultGitlabRootURL)
 
-		return defaultGitlabRootURL, nil
+		lintURL, project, _, err := gitlabProjectLintURL(defaultGitlabRootURL, "")
+		return lintURL, project, err
 	}
 
-	// Extract origin remote url from repository config
-	remoteURL, err := getGitOriginRemoteURL(gitRepoPath)
+	// Guess gitlab url based on the url of the git remote identifying the Gitlab project
+	remote, err := findGitlabRemote(gitRepoPath)
 	if err != nil {
-		return defaultGitlabRootURL, fmt.Errorf("failed to find origin remote url in repository: %s", err)
+		return defaultGitlabRootURL, "", err
 	}
-
-	// Check if we can use the origin remote url
-	if remoteURL != "" {
-		// Guess gitlab url based on remote url
-		localGitlabRootURL, err := guessGitlabAPIFromGitRemoteURL(remoteURL)
-		if err != nil {
-			return defaultGitlabRootURL, fmt.Errorf("no valid and responding Gitlab API URL found from repository's origin remote: %s", err)
-		}
-		return localGitlabRootURL, nil
+	if remote != nil {
+		reportGitlabRemote(remote)
+		return remote.lintURL, remote.project, nil
 	}
 
-	// Warn user that we're defaulting because no origin remote was found
+	// Warn user that we're defaulting because no remote was found
 	yellow := color.New(color.FgYellow).SprintFunc()
-	fmt.Fprintf(color.Output, yellow("No origin remote found in repository, using default Gitlab API '%s'\n"), gitlabRootURL)
+	fmt.Fprintf(messageOutput, yellow("No remote found in repository, using default Gitlab API '%s'\n"), defaultGitlabRootURL)
 
-	return defaultGitlabRootURL, nil
+	lintURL, project, _, err := gitlabProjectLintURL(defaultGitlabRootURL, "")
+	return lintURL, project, err
 }
 
 // 'check' command of the program, which is the main action
-// It aims to validate the syntax of a .gitlab-ci.yml file, using the CI Lint API of a Gitlab instance
+// It aims to validate the syntax of .gitlab-ci.yml files, using the CI Lint API of a Gitlab instance
 // First it search for a gitlab-ci file if no one is given
-// Then it search for a .git repository directory
+// Then, for each file, it search for a .git repository directory
 // If a .git repository is found, its origin remote is analysed to extract and guess a the Gitlab root url to use for
 // the API. If no valid origin remote or API is found, the defaultGitlabRootURL is used
 // Finally, it call the API with the gitlab-ci file content. If the content if syntax valid, it silently stop. Else it
 // display the error messages returned by the API and exit with an error
+// Files are checked concurrently, but their results are displayed in the order of the arguments.
 func commandCheck(c *cli.Context) error {
 
-	if c.Args().Present() && c.Args().Get(0) != "" {
-		processPathArgument(c.Args().Get(0))
+	if verboseMode {
+		fmt.Fprintf(messageOutput, "Settings:\n  directoryRoot: %s\n  gitlabCiFilePath: %s\n", directoryRoot, gitlabCiFilePath)
 	}
 
-	if verboseMode {
-		fmt.Printf("Settings:\n  directoryRoot: %s\n  gitlabCiFilePath: %s\n", directoryRoot, gitlabCiFilePath)
+	// As a hook, avoid calling the API when the commit does not change the CI configuration
+	if isRunningAsGitHook() && c.Args().Len() == 0 {
+		if reason := hookCheckSkipReason(); reason != "" {
+			if verboseMode {
+				fmt.Fprintf(messageOutput, "Check skipped: %s\n", reason)
+			}
+			return nil
+		}
+	}
+
+	// The CI configuration stored at a ref of the Gitlab project is validated instead of local files
+	if remoteRef != "" {
+		if c.Args().Len() > 0 {
+			return cli.Exit("PATH arguments can't be given with --remote-ref", 1)
+		}
+		result := checkGitlabCiRemoteRef(remoteRef)
+		if err := writeCheckResult(result); err != nil {
+			return cli.Exit(err, 5)
+		}
+		return finishCheck([]*CheckResult{result})
+	}
+
+	files := collectGitlabCiFiles(c.Args().Slice())
+	if len(files) == 0 {
+		fmt.Fprintln(messageOutput, "No gitlab-ci file found")
+		return nil
+	}
+
+	var outputErr error
+	results := checkGitlabCiFiles(files, func(result *CheckResult) {
+		if err := writeCheckResult(result); err != nil && outputErr == nil {
+			outputErr = err
+		}
+	})
+	if outputErr != nil {
+		return cli.Exit(outputErr, 5)
+	}
+
+	return finishCheck(results)
+}
+
+// Writes a check result in the output format
+func writeCheckResult(result *CheckResult) error {
+	if outputFormat == outputFormatJSON {
+		return writeJSONCheckResult(os.Stdout, result)
+	}
+	writeTextCheckResult(result)
+	return nil
+}
+
+// Writes the reports and the merged yaml of the check results, and returns the exit status of the program
+func finishCheck(results []*CheckResult) error {
+	if err := writeReports(results); err != nil {
+		return cli.Exit(err, 5)
+	}
+
+	if mergedYamlOutput != "" {
+		if err := writeMergedYaml(results); err != nil {
+			return cli.Exit(err, 5)
+		}
 	}
 
-	// Find gitlab-ci file, if not given
-	if gitlabCiFilePath == "" {
-		file, err := findGitlabCiFile(directoryRoot)
+	return checkExitCode(results)
+}
+
+// ciFileTarget struct represents a gitlab-ci file to check
+type ciFileTarget struct {
+	// Absolute path of the file
+	path string
+	// Tells if the file is a fragment, validated through a generated file including it
+	wrap bool
+}
+
+// Returns the gitlab-ci files to check, from the PATH arguments
+// A file argument is checked as is, a directory argument is used to search for a gitlab-ci file. Without arguments,
+// the --ci-file is checked, or a gitlab-ci file is searched from --directory.
+func collectGitlabCiFiles(args []string) []ciFileTarget {
+	files := []ciFileTarget{}
+	seen := map[string]bool{}
+	addFile := func(file ciFileTarget) {
+		if !seen[file.path] {
+			seen[file.path] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, arg := range args {
+		if arg == "" {
+			continue
+		}
+		path, _ := filepath.Abs(arg)
+		fileInfo, err := os.Stat(path)
+		if err == nil && fileInfo.IsDir() && recursiveMode {
+			found, err := findGitlabCiFilesRecursively(path)
+			if err != nil {
+				fmt.Fprintf(messageOutput, "Unable to search gitlab-ci files in %s: %s\n", arg, err)
+			}
+			for _, file := range found {
+				addFile(file)
+			}
+			continue
+		}
+		if err == nil && fileInfo.IsDir() {
+			if file, err := findGitlabCiFileFrom(path); err == nil {
+				addFile(ciFileTarget{path: file})
+			} else if verboseMode {
+				fmt.Fprintf(messageOutput, "No gitlab-ci file found from %s\n", arg)
+			}
+			continue
+		}
+		// Non existing files are kept, to be reported as failed checks
+		addFile(ciFileTarget{path: path})
+	}
+
+	if len(files) > 0 || len(args) > 0 {
+		return files
+	}
+
+	if gitlabCiFilePath != "" {
+		return []ciFileTarget{{path: gitlabCiFilePath}}
+	}
+	if recursiveMode {
+		found, err := findGitlabCiFilesRecursively(directoryRoot)
 		if err != nil {
-			fmt.Println("No gitlab-ci file found")
-			return nil
+			fmt.Fprintf(messageOutput, "Unable to search gitlab-ci files in %s: %s\n", directoryRoot, err)
 		}
-		gitlabCiFilePath = file
+		return found
+	}
+	if file, err := findGitlabCiFileFrom(directoryRoot); err == nil {
+		return []ciFileTarget{{path: file}}
 	}
 
-	cwd, _ := os.Getwd()
-	relativeGitlabCiFilePath, _ := filepath.Rel(cwd, gitlabCiFilePath)
+	return files
+}
 
-	// Find git repository. First, start from gitlab-ci file location
-	gitRepoPath, err := findGitRepo(filepath.Dir(gitlabCiFilePath))
-	if err == nil {
-		// if not found, search from directoryRoot
-		gitRepoPath, _ = findGitRepo(directoryRoot)
+// Tells why the check can be skipped when running as a git hook, from the files staged in the git index: the check is
+// only needed if the gitlab-ci file, one of its local includes, or a file matching hookTriggerPatterns is staged.
+// A deleted yaml file may have been included, so it also triggers the check.
+// Returns an empty string if the check is needed, or if it can't be determined locally.
+func hookCheckSkipReason() string {
+	gitRepoPath, err := findGitRepo(directoryRoot)
+	if err != nil {
+		return ""
+	}
+	staged, err := readGitStagedFiles(gitRepoPath)
+	if err != nil {
+		if verboseMode {
+			fmt.Fprintf(messageOutput, "Unable to get the staged files: %s\n", err)
+		}
+		return ""
+	}
+	if len(staged) == 0 {
+		return "no file is staged"
 	}
 
-	localGitlabLintURL, err := getGitlabLintURL(gitRepoPath)
+	triggers := make([]*regexp.Regexp, 0, len(hookTriggerPatterns))
+	for _, pattern := range hookTriggerPatterns {
+		re, err := includeGlobToRegexp(strings.TrimPrefix(pattern, "/"))
+		if err != nil {
+			return ""
+		}
+		triggers = append(triggers, re)
+	}
+
+	stagedPaths := map[string]bool{}
+	for _, file := range staged {
+		stagedPaths[file.path] = true
+		if file.deleted && (strings.HasSuffix(file.path, ".yml") || strings.HasSuffix(file.path, ".yaml")) {
+			return ""
+		}
+		for _, re := range triggers {
+			if re.MatchString(file.path) {
+				return ""
+			}
+		}
+	}
+
+	// The gitlab-ci file is searched locally: the CI configuration path of the Gitlab project would need the API
+	ciFilePath := gitlabCiFilePath
+	if ciFilePath == "" {
+		if ciFilePath, err = findGitlabCiFile(directoryRoot); err != nil {
+			return ""
+		}
+	}
+	workTree := gitWorkTree(gitRepoPath)
+	relativePath, err := filepath.Rel(workTree, ciFilePath)
+	if workTree == "" || err != nil || strings.HasPrefix(relativePath, "..") || stagedPaths[filepath.ToSlash(relativePath)] {
+		return ""
+	}
+
+	content, files, err := readGitlabCiFile(ciFilePath, gitRepoPath)
 	if err != nil {
-		return cli.Exit(err, 5)
+		return ""
+	}
+	_, included, err := inlineGitlabCiLocalIncludes(content, files)
+	if err != nil {
+		return ""
+	}
+	for _, file := range included {
+		if stagedPaths[file.path] {
+			return ""
+		}
 	}
 
-	fmt.Printf("Validating %s... ", relativeGitlabCiFilePath)
+	return fmt.Sprintf("none of %s and its local includes is staged", displayFilePath(ciFilePath))
+}
 
-	if verboseMode {
-		fmt.Printf("\n")
+// Checks gitlab-ci files concurrently, with at most checkConcurrency checks at the same time
+// The onResult function is called with each result, in the order of the files, as soon as possible.
+// All the results are returned, in the order of the files.
+func checkGitlabCiFiles(files []ciFileTarget, onResult func(*CheckResult)) []*CheckResult {
+	results := make([]*CheckResult, len(files))
+	done := make([]chan struct{}, len(files))
+	for i := range done {
+		done[i] = make(chan struct{})
 	}
 
-	// Call the API to validate the gitlab-ci file
-	ciFileContent, err := os.ReadFile(gitlabCiFilePath)
+	workers := max(1, min(checkConcurrency, len(files)))
+	indexes := make(chan int)
+	for range workers {
+		go func() {
+			for i := range indexes {
+				results[i] = checkGitlabCiFile(files[i])
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := range files {
+			indexes <- i
+		}
+		close(indexes)
+	}()
+
+	for i := range files {
+		<-done[i]
+		onResult(results[i])
+	}
+
+	return results
+}
+
+// Returns the path of a file to display: relative to the working directory if possible
+func displayFilePath(filePath string) string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return filePath
+	}
+	relativePath, err := filepath.Rel(cwd, filePath)
+	if err != nil {
+		return filePath
+	}
+	return relativePath
+}
+
+// Returns the ref to use to validate a gitlab-ci file: the one given with --dry-run-ref, or else the current branch
+// of its git repository
+func resolveLintRef(gitRepoPath string) string {
+	if dryRunRef != "" || gitRepoPath == "" {
+		return dryRunRef
+	}
+	ref, _ := GetCurrentBranch(gitRepoPath)
+	return ref
+}
+
+// Resolution of the Gitlab lint API of a git repository, shared by the checks of all its files
+type lintTarget struct {
+	once    sync.Once
+	lintURL string
+	project string
+	err     error
+
+	ciConfigOnce sync.Once
+	ciConfigPath string
+}
+
+// Lint API resolutions, by git repository path
+var lintTargets = map[string]*lintTarget{}
+var lintTargetsMutex sync.Mutex
+
+// Returns the lint API resolution of a git repository, creating it if needed
+func getLintTarget(gitRepoPath string) *lintTarget {
+	lintTargetsMutex.Lock()
+	defer lintTargetsMutex.Unlock()
+
+	target, ok := lintTargets[gitRepoPath]
+	if !ok {
+		target = &lintTarget{}
+		lintTargets[gitRepoPath] = target
+	}
+
+	return target
+}
+
+// Returns the Gitlab lint API URL to use for a git repository, and the Gitlab project it targets
+// The resolution is done only once per repository, even when called concurrently.
+func getCachedGitlabLintURL(gitRepoPath string) (string, string, error) {
+	target := getLintTarget(gitRepoPath)
+	target.once.Do(func() {
+		target.lintURL, target.project, target.err = getGitlabLintURL(gitRepoPath)
+	})
+
+	return target.lintURL, target.project, target.err
+}
+
+// Returns the CI configuration path set in the settings of the Gitlab project of a git repository
+// The project is queried only once per repository. An empty string is returned if the path can't be known, or if it
+// is not a file of the repository (e.g. a file in another project, or a remote URL).
+func getCachedProjectCiConfigPath(gitRepoPath string) string {
+	target := getLintTarget(gitRepoPath)
+	target.ciConfigOnce.Do(func() {
+		lintURL, _, err := getCachedGitlabLintURL(gitRepoPath)
+		if err != nil {
+			return
+		}
+		projectURL := gitlabProjectURLFromLintURL(lintURL)
+		if projectURL == "" {
+			return
+		}
+		project, err := getGitlabProject(projectURL)
+		if err != nil {
+			if verboseMode {
+				fmt.Fprintf(messageOutput, "Unable to get the CI configuration path of the project: %s\n", err)
+			}
+			return
+		}
+		if strings.Contains(project.CiConfigPath, "@") || strings.Contains(project.CiConfigPath, "://") {
+			if verboseMode {
+				fmt.Fprintf(messageOutput, "CI configuration path of the project '%s' is not a local file, ignored\n", project.CiConfigPath)
+			}
+			return
+		}
+		target.ciConfigPath = project.CiConfigPath
+	})
+
+	return target.ciConfigPath
+}
+
+// Search a gitlab-ci file from a directory
+// If the directory is in a git repository whose Gitlab project has a custom CI configuration path, this file is used.
+// Else, a file matching gitlabCiFilePatterns is searched in the directory and its parents.
+func findGitlabCiFileFrom(directory string) (string, error) {
+	if gitRepoPath, err := findGitRepo(directory); err == nil && gitWorkTree(gitRepoPath) != "" {
+		if ciConfigPath := getCachedProjectCiConfigPath(gitRepoPath); ciConfigPath != "" {
+			candidate := filepath.Join(gitWorkTree(gitRepoPath), filepath.FromSlash(ciConfigPath))
+			if fileInfo, err := os.Stat(candidate); err == nil && !fileInfo.IsDir() {
+				if verboseMode {
+					fmt.Fprintf(messageOutput, "Using the CI configuration path of the project: %s\n", ciConfigPath)
+				}
+				return candidate, nil
+			}
+			if verboseMode {
+				fmt.Fprintf(messageOutput, "CI configuration path of the project '%s' not found in the repository\n", ciConfigPath)
+			}
+		}
+	}
+
+	return findGitlabCiFile(directory)
+}
+
+// Checks a gitlab-ci file: find the Gitlab lint API to use, and send it the file content
+// The returned result holds the error that prevented the check to complete, if any
+func checkGitlabCiFile(target ciFileTarget) *CheckResult {
+	filePath := target.path
+	displayPath := displayFilePath(filePath)
+	result := newCheckResult(displayPath)
+	defer result.finish()
+
+	gitRepoPath := findGitRepoOfFile(filePath)
+
+	ciFileContent, files, err := readGitlabCiFile(filePath, gitRepoPath)
 	if err != nil {
-		return cli.Exit(fmt.Sprintf("error while reading '%s' file content: %s", relativeGitlabCiFilePath, err), 5)
+		result.setError(fmt.Errorf("error while reading '%s' file content: %s", displayPath, err))
+		return result
+	}
+	// A wrapped fragment is validated through a generated file including it
+	locatedContent := ciFileContent
+	if target.wrap {
+		relativePath := ""
+		if files != nil {
+			relativePath, err = filepath.Rel(gitWorkTree(gitRepoPath), filePath)
+		}
+		if files == nil || err != nil || strings.HasPrefix(relativePath, "..") {
+			result.setError(fmt.Errorf("unable to wrap '%s': it is not in the work tree of a git repository", displayPath))
+			return result
+		}
+		ciFileContent = fragmentWrapperContent(filepath.ToSlash(relativePath))
+		locatedContent = nil
 	}
 
-	status, errorMessages, err := lintGitlabCIUsingAPI(localGitlabLintURL, string(ciFileContent))
+	localGitlabLintURL, project, err := getCachedGitlabLintURL(gitRepoPath)
 	if err != nil {
-		return cli.Exit(fmt.Errorf("error linting using Gitlab API %s: %w", localGitlabLintURL, err), 5)
+		result.setError(err)
+		return result
 	}
+	result.LintURL = localGitlabLintURL
+	result.Project = project
+	result.Ref = resolveLintRef(gitRepoPath)
 
-	if !status {
-		if verboseMode {
-			fmt.Printf("%s ", relativeGitlabCiFilePath)
+	if verboseMode {
+		fmt.Fprintf(messageOutput, "Validating %s using %s...\n", displayPath, localGitlabLintURL)
+	}
+
+	// Inline the local includes, so they are validated as they are in the working tree (or in the index)
+	lintContent := ciFileContent
+	var included []includedFile
+	workTree := ""
+	if inlineLocalIncludes && files != nil {
+		workTree = gitWorkTree(gitRepoPath)
+		lintContent, included, err = inlineGitlabCiLocalIncludes(ciFileContent, files)
+		if err != nil {
+			yellow := color.New(color.FgYellow).SprintFunc()
+			fmt.Fprintf(messageOutput, yellow("Local includes of %s not inlined, the versions of the remote ref will be used: %s\n"), displayPath, err)
+		} else if verboseMode && len(included) > 0 {
+			fmt.Fprintf(messageOutput, "Local includes of %s inlined: %s\n", displayPath, includedFilePaths(included))
 		}
+	}
 
-		red := color.New(color.FgRed).SprintFunc()
-		fmt.Fprintf(color.Output, "%s\n", red("KO"))
+	// Call the API to validate the gitlab-ci file
+	response, err := lintGitlabCIUsingAPI(localGitlabLintURL, string(lintContent), result.Ref)
+	if err != nil {
+		result.setError(fmt.Errorf("error linting using Gitlab API %s: %w", localGitlabLintURL, err))
+		return result
+	}
+	result.setLintResponse(response)
+	locateLintMessages(locatedContent, result.Messages, included, workTree, len(included) == 0 && locatedContent != nil)
 
-		messages := red(strings.Join(errorMessages, "\n"))
-		fmt.Fprintf(os.Stderr, "%s\n", messages)
+	return result
+}
 
-		return cli.Exit("", 10)
+// Reads the content of a gitlab-ci file to check, and returns it with the source of the files of its repository
+// In staged mode, the file and its local includes are read from the git index. A file that is not in the index is read
+// from the working tree. Without repository or work tree, no repository files are returned.
+func readGitlabCiFile(filePath string, gitRepoPath string) ([]byte, repositoryFiles, error) {
+	workTree := ""
+	if gitRepoPath != "" {
+		workTree = gitWorkTree(gitRepoPath)
+	}
+	if workTree == "" {
+		content, err := os.ReadFile(filePath) // #nosec G304
+		return content, nil, err
+	}
+
+	if !stagedMode {
+		content, err := os.ReadFile(filePath) // #nosec G304
+		return content, newWorkTreeFiles(workTree, gitRepoPath), err
 	}
 
+	files, err := newIndexFiles(gitRepoPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	relativePath, err := filepath.Rel(workTree, filePath)
+	if err == nil && !strings.HasPrefix(relativePath, "..") {
+		content, err := files.readFile(filepath.ToSlash(relativePath))
+		if !errors.Is(err, os.ErrNotExist) {
+			return content, files, err
+		}
+	}
 	if verboseMode {
-		fmt.Printf("%s ", relativeGitlabCiFilePath)
+		fmt.Fprintf(messageOutput, "%s is not staged, the working tree version is used\n", displayFilePath(filePath))
+	}
+	content, err := os.ReadFile(filePath) // #nosec G304
+	return content, files, err
+}
+
+// Returns the exit status of the program corresponding to all the check results
+// A check that could not complete has precedence over an invalid file, which has precedence over warnings.
+func checkExitCode(results []*CheckResult) error {
+	exitCode := 0
+	for _, result := range results {
+		switch {
+		case result.err != nil:
+			exitCode = 5
+		case !result.Valid && exitCode != 5:
+			exitCode = 10
+		case failOnWarnings && len(result.Warnings) > 0 && exitCode == 0:
+			exitCode = 11
+		}
 	}
-	green := color.New(color.FgGreen).SprintFunc()
-	fmt.Fprintf(color.Output, "%s\n", green("OK"))
 
+	if exitCode != 0 {
+		return cli.Exit("", exitCode)
+	}
 	return nil
 }
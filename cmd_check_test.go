@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestCheckExitCode(t *testing.T) {
+	valid := &CheckResult{Valid: true}
+	warning := &CheckResult{Valid: true, Warnings: []string{"jobs:build may allow multiple pipelines"}}
+	invalid := &CheckResult{Valid: false}
+	failed := &CheckResult{err: errors.New("HTTP request error")}
+
+	testData := []struct {
+		name           string
+		results        []*CheckResult
+		failOnWarnings bool
+		expected       int
+	}{
+		{"valid", []*CheckResult{valid, valid}, false, 0},
+		{"warnings", []*CheckResult{valid, warning}, false, 0},
+		{"fail on warnings", []*CheckResult{warning, valid}, true, 11},
+		{"invalid", []*CheckResult{warning, invalid, valid}, true, 10},
+		{"failed", []*CheckResult{failed, invalid, warning}, true, 5},
+		{"failed last", []*CheckResult{invalid, failed}, false, 5},
+	}
+
+	defer func(value bool) { failOnWarnings = value }(failOnWarnings)
+	for _, data := range testData {
+		t.Run(data.name, func(t *testing.T) {
+			failOnWarnings = data.failOnWarnings
+			exitCode := 0
+			if err := checkExitCode(data.results); err != nil {
+				var exitCoder cli.ExitCoder
+				if errors.As(err, &exitCoder) {
+					exitCode = exitCoder.ExitCode()
+				}
+			}
+			if exitCode != data.expected {
+				t.Errorf("received exit code %d while expecting %d", exitCode, data.expected)
+			}
+		})
+	}
+}
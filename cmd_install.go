@@ -22,7 +22,6 @@ package main
 
 import (
 	"fmt"
-	"path/filepath"
 
 	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
@@ -35,11 +34,10 @@ func commandInstall(c *cli.Context) error {
 		processPathArgument(c.Args().Get(0))
 	}
 
-	// Find git repository. First, start from gitlab-ci file location
-	gitRepoPath, err := findGitRepo(filepath.Dir(gitlabCiFilePath))
-	if err == nil {
-		// if not found, search from directoryRoot
-		gitRepoPath, _ = findGitRepo(directoryRoot)
+	// Find git repository. First, start from gitlab-ci file location, then from directoryRoot
+	gitRepoPath, _ := findGitRepo(directoryRoot)
+	if gitlabCiFilePath != "" {
+		gitRepoPath = findGitRepoOfFile(gitlabCiFilePath)
 	}
 
 	if gitRepoPath == "" {
@@ -49,40 +47,35 @@ func commandInstall(c *cli.Context) error {
 		fmt.Printf("Git repository found: %s\n", gitRepoPath)
 	}
 
-	// Extract origin remote url from repository config
-	remoteURL, err := getGitOriginRemoteURL(gitRepoPath)
+	// Check if a git remote identifies a responding Gitlab project
+	remote, err := findGitlabRemote(gitRepoPath)
 	if err != nil {
-		return cli.Exit(fmt.Sprintf("Failed to find origin remote url in repository: %s", err), 5)
+		return cli.Exit(fmt.Sprintf("%s, can't install a hook", err), 5)
 	}
-
-	// Check if we can use the origin remote url
-	if remoteURL != "" {
-		// Guess gitlab url based on remote url
-		_, err = guessGitlabAPIFromGitRemoteURL(remoteURL)
-		if err != nil {
-			return cli.Exit("No valid and responding Gitlab API URL found from repository's origin remote, can't install a hook", 5)
-		}
+	if remote != nil {
+		reportGitlabRemote(remote)
 	} else if verboseMode {
-		// Warn user that we're defaulting because no origin remote was found
+		// Warn user that we're defaulting because no remote was found
 		yellow := color.New(color.FgYellow).SprintFunc()
-		fmt.Fprintf(color.Output, yellow("No origin remote found in repository, will be using default Gitlab API '%s'\n"), gitlabRootURL)
+		fmt.Fprintf(color.Output, yellow("No remote found in repository, will be using default Gitlab API '%s'\n"), defaultGitlabRootURL)
 	}
 
-	status, err := createGitHookLink(gitRepoPath, "pre-commit")
+	hookPath := gitHookPath(gitRepoPath, preCommitHookName)
+	status, err := createGitHookLink(gitRepoPath, preCommitHookName)
 	if err != nil {
 		return cli.Exit(err, 5)
 	}
 	switch status {
 	case HookAlreadyExists:
 		yellow := color.New(color.FgYellow).SprintFunc()
-		msg := yellow("A pre-commit hook already exists\nPlease install manually by adding a call to me in your pre-commit script.")
+		msg := yellow(fmt.Sprintf("A pre-commit hook already exists in %s\nPlease install manually by adding a call to me in your pre-commit script.", hookPath))
 		return cli.Exit(msg, 4)
 	case HookAlreadyCreated:
 		cyan := color.New(color.FgCyan).SprintFunc()
-		fmt.Fprintf(color.Output, "%s\n", cyan("Already installed."))
+		fmt.Fprintf(color.Output, "%s\n", cyan(fmt.Sprintf("Already installed in %s.", hookPath)))
 	case HookCreated:
 		green := color.New(color.FgGreen).SprintFunc()
-		fmt.Fprintf(color.Output, "%s\n", green(fmt.Sprintf("Git pre-commit hook installed in %s", filepath.Dir(gitRepoPath))))
+		fmt.Fprintf(color.Output, "%s\n", green(fmt.Sprintf("Git pre-commit hook installed in %s", hookPath)))
 	default:
 		return cli.Exit("Unkown error", 5)
 	}
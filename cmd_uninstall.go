@@ -22,7 +22,6 @@ package main
 
 import (
 	"fmt"
-	"path/filepath"
 
 	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
@@ -35,11 +34,10 @@ func commandUninstall(c *cli.Context) error {
 		processPathArgument(c.Args().Get(0))
 	}
 
-	// Find git repository. First, start from gitlab-ci file location
-	gitRepoPath, err := findGitRepo(filepath.Dir(gitlabCiFilePath))
-	if err == nil {
-		// if not found, search from directoryRoot
-		gitRepoPath, _ = findGitRepo(directoryRoot)
+	// Find git repository. First, start from gitlab-ci file location, then from directoryRoot
+	gitRepoPath, _ := findGitRepo(directoryRoot)
+	if gitlabCiFilePath != "" {
+		gitRepoPath = findGitRepoOfFile(gitlabCiFilePath)
 	}
 
 	if gitRepoPath == "" {
@@ -49,20 +47,21 @@ func commandUninstall(c *cli.Context) error {
 		fmt.Printf("Git repository found: %s\n", gitRepoPath)
 	}
 
-	status, err := deleteGitHookLink(gitRepoPath, "pre-commit")
+	hookPath := gitHookPath(gitRepoPath, preCommitHookName)
+	status, err := deleteGitHookLink(gitRepoPath, preCommitHookName)
 	if err != nil {
 		return cli.Exit(err, 5)
 	}
 	switch status {
 	case HookNotMatching:
 		red := color.New(color.FgRed).SprintFunc()
-		return cli.Exit(red("Unknown pre-commit hook\nPlease uninstall manually."), 4)
+		return cli.Exit(red(fmt.Sprintf("Unknown pre-commit hook in %s\nPlease uninstall manually.", hookPath)), 4)
 	case HookNotExisting:
 		yellow := color.New(color.FgYellow).SprintFunc()
-		fmt.Fprintf(color.Output, "%s\n", yellow("No pre-commit hook found."))
+		fmt.Fprintf(color.Output, "%s\n", yellow(fmt.Sprintf("No pre-commit hook found in %s.", hookPath)))
 	case HookDeleted:
 		green := color.New(color.FgGreen).SprintFunc()
-		fmt.Fprintf(color.Output, "%s\n", green("Git pre-commit hook uninstalled."))
+		fmt.Fprintf(color.Output, "%s\n", green(fmt.Sprintf("Git pre-commit hook uninstalled from %s.", hookPath)))
 	default:
 		return cli.Exit("Unknown error", 5)
 	}
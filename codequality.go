@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Check names of the Code Quality issues
+const (
+	codeQualityCheckError   = "gitlab-ci-lint-error"
+	codeQualityCheckWarning = "gitlab-ci-lint-warning"
+)
+
+// Severities of the Code Quality issues
+const (
+	codeQualitySeverityMajor = "major"
+	codeQualitySeverityMinor = "minor"
+)
+
+// CodeQualityIssue struct represents an issue of a Gitlab Code Quality report (a subset of the CodeClimate format)
+type CodeQualityIssue struct {
+	Type        string              `json:"type"`
+	CheckName   string              `json:"check_name"`
+	Description string              `json:"description"`
+	Categories  []string            `json:"categories"`
+	Fingerprint string              `json:"fingerprint"`
+	Severity    string              `json:"severity"`
+	Location    CodeQualityLocation `json:"location"`
+}
+
+// CodeQualityLocation struct represents the location of a Code Quality issue
+type CodeQualityLocation struct {
+	Path  string           `json:"path"`
+	Lines CodeQualityLines `json:"lines"`
+}
+
+// CodeQualityLines struct represents the lines of a Code Quality issue location
+type CodeQualityLines struct {
+	Begin int `json:"begin"`
+}
+
+// Computes a fingerprint of an issue, that is stable across runs as long as the issue is the same, at the same line
+func codeQualityFingerprint(path string, line int, checkName string, description string) string {
+	sum := sha256.Sum256([]byte(path + "\x00" + strconv.Itoa(line) + "\x00" + checkName + "\x00" + description))
+	return hex.EncodeToString(sum[:])
+}
+
+// Creates a Code Quality issue for a lint message of a checked file
+// Messages with an unknown position are located on the first line of the file.
+func newCodeQualityIssue(path string, msg LintMessage) CodeQualityIssue {
+	checkName, severity := codeQualityCheckError, codeQualitySeverityMajor
+	if msg.Severity == lintSeverityWarning {
+		checkName, severity = codeQualityCheckWarning, codeQualitySeverityMinor
+	}
+
+	line := msg.Line
+	if line < 1 {
+		line = 1
+	}
+
+	path = msg.location(path)
+
+	return CodeQualityIssue{
+		Type:        "issue",
+		CheckName:   checkName,
+		Description: msg.Message,
+		Categories:  []string{"Bug Risk"},
+		Fingerprint: codeQualityFingerprint(path, line, checkName, msg.Message),
+		Severity:    severity,
+		Location: CodeQualityLocation{
+			Path:  path,
+			Lines: CodeQualityLines{Begin: line},
+		},
+	}
+}
+
+// Writes a Gitlab Code Quality report of check results
+// Lint errors are major issues, and warnings minor ones. Checks that could not complete are not reported, as they
+// are not issues of the files.
+func writeCodeQualityReport(w io.Writer, results []*CheckResult) error {
+	issues := []CodeQualityIssue{}
+
+	for _, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		for _, msg := range result.Messages {
+			issues = append(issues, newCodeQualityIssue(result.File, msg))
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(issues); err != nil {
+		return fmt.Errorf("unable to encode Code Quality report: %w", err)
+	}
+
+	return nil
+}
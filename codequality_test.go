@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestWriteCodeQualityReport(t *testing.T) {
+	newResults := func() []*CheckResult {
+		invalid := newCheckResult(".gitlab-ci.yml")
+		invalid.setLintResponse(GitlabAPILintResponse{
+			Errors: []string{"jobs:build:script config should be an array", "root config contains unknown keys: foo",
+				"jobs:build:script config should be an array"},
+			Warnings: []string{"jobs:test may allow multiple pipelines to run for a single action"},
+		})
+		invalid.Messages[0].Line, invalid.Messages[0].Column = 12, 3
+		invalid.Messages[1].File = "ci/build.yml"
+		// The same message at another place
+		invalid.Messages[2].Line, invalid.Messages[2].Column = 20, 3
+		failed := newCheckResult("ci/failed.yml")
+		failed.setError(errors.New("unable to read file"))
+		return []*CheckResult{invalid, failed}
+	}
+
+	writeReport := func() []CodeQualityIssue {
+		var buf bytes.Buffer
+		if err := writeCodeQualityReport(&buf, newResults()); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var issues []CodeQualityIssue
+		if err := json.Unmarshal(buf.Bytes(), &issues); err != nil {
+			t.Fatalf("unable to decode Code Quality report: %s", err)
+		}
+		return issues
+	}
+
+	issues := writeReport()
+	if len(issues) != 4 {
+		t.Fatalf("received %d issues while expecting 4", len(issues))
+	}
+
+	expected := []struct {
+		checkName string
+		severity  string
+		path      string
+		line      int
+	}{
+		{codeQualityCheckError, codeQualitySeverityMajor, ".gitlab-ci.yml", 12},
+		{codeQualityCheckError, codeQualitySeverityMajor, "ci/build.yml", 1},
+		{codeQualityCheckError, codeQualitySeverityMajor, ".gitlab-ci.yml", 20},
+		{codeQualityCheckWarning, codeQualitySeverityMinor, ".gitlab-ci.yml", 1},
+	}
+	for i, exp := range expected {
+		issue := issues[i]
+		if issue.Type != "issue" || issue.CheckName != exp.checkName || issue.Severity != exp.severity {
+			t.Errorf("issue %d: received type '%s', check '%s' and severity '%s' while expecting 'issue', '%s' and '%s'",
+				i, issue.Type, issue.CheckName, issue.Severity, exp.checkName, exp.severity)
+		}
+		if issue.Location.Path != exp.path || issue.Location.Lines.Begin != exp.line {
+			t.Errorf("issue %d: received location %s:%d while expecting %s:%d",
+				i, issue.Location.Path, issue.Location.Lines.Begin, exp.path, exp.line)
+		}
+	}
+
+	fingerprints := map[string]bool{}
+	for i, issue := range issues {
+		if len(issue.Fingerprint) != 64 {
+			t.Errorf("issue %d: received fingerprint '%s' while expecting a SHA-256 hex digest", i, issue.Fingerprint)
+		}
+		if fingerprints[issue.Fingerprint] {
+			t.Errorf("issue %d: fingerprint '%s' is not unique", i, issue.Fingerprint)
+		}
+		fingerprints[issue.Fingerprint] = true
+	}
+
+	for i, issue := range writeReport() {
+		if issue.Fingerprint != issues[i].Fingerprint {
+			t.Errorf("issue %d: fingerprint changed across runs, from '%s' to '%s'", i, issues[i].Fingerprint, issue.Fingerprint)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/mitchellh/go-homedir"
+	"gopkg.in/yaml.v3"
+)
+
+// Name of the project config file, at the root of the work tree of a repository
+const projectConfigFilename = ".gitlab-ci-linter.yml"
+
+// Path of the user config file. If empty, $XDG_CONFIG_HOME/gitlab-ci-linter/config.yml (or
+// ~/.config/gitlab-ci-linter/config.yml) is used, when it exists.
+var userConfigPath = ""
+
+// configFile struct represents the content of a user or project config file
+type configFile struct {
+	Hosts []hostConfig `yaml:"hosts"`
+	// Tells if the hosts settings of the project config files can map a remote to the API of another host, which then
+	// receives the token. Only allowed in the user config file.
+	TrustProjectHosts bool `yaml:"trust-project-hosts,omitempty"`
+}
+
+// hostConfig struct represents the settings of a host in a config file
+// The host is matched by name (Host), or by a regular expression (HostRegexp) whose groups can be referenced in the
+// settings as $1, ${name}...
+type hostConfig struct {
+	Host       string `yaml:"host,omitempty"`
+	HostRegexp string `yaml:"host-regexp,omitempty"`
+	// Root URL of the Gitlab instance of the remotes on this host, with its relative path prefix if any
+	URL string `yaml:"url,omitempty"`
+	// TLS settings of the connections to the Gitlab API on this host
+	tlsSettings `yaml:",inline"`
+
+	re *regexp.Regexp
+	// Tells if the settings come from an untrusted project config file: its url can't lead to another host
+	untrusted bool
+}
+
+// Hosts for which the ignored mapping of a project config file was already warned about
+var untrustedMappingWarnedHosts sync.Map
+
+// Returns the path of the user config file, and tells if it was explicitly given
+func getUserConfigPath() (string, bool) {
+	if userConfigPath != "" {
+		return userConfigPath, true
+	}
+	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
+		return filepath.Join(xdgConfigHome, "gitlab-ci-linter", "config.yml"), false
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(home, ".config", "gitlab-ci-linter", "config.yml"), false
+}
+
+// Reads a config file, and validates its content
+// A missing file is not an error, unless required.
+func readConfigFile(path string, required bool) (*configFile, error) {
+	content, err := os.ReadFile(path) // #nosec G304
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return &configFile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+
+	cfg := &configFile{}
+	if err := yaml.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config file '%s': %w", path, err)
+	}
+	for i := range cfg.Hosts {
+		host := &cfg.Hosts[i]
+		if (host.Host == "") == (host.HostRegexp == "") {
+			return nil, fmt.Errorf("invalid config file '%s': hosts entry %d must have either a host or a host-regexp", path, i+1)
+		}
+		if host.HostRegexp != "" {
+			if host.re, err = regexp.Compile(host.HostRegexp); err != nil {
+				return nil, fmt.Errorf("invalid config file '%s': invalid host-regexp '%s': %w", path, host.HostRegexp, err)
+			}
+		}
+		if host.ClientKey != "" && host.ClientCert == "" {
+			return nil, fmt.Errorf("invalid config file '%s': hosts entry %d has a client-key without client-cert", path, i+1)
+		}
+		if host.MinVersion != "" {
+			var ok bool
+			if host.MinVersion, ok = normalizeTLSVersion(host.MinVersion); !ok {
+				return nil, fmt.Errorf("invalid config file '%s': unsupported TLS version '%s'", path, host.MinVersion)
+			}
+		}
+		host.resolvePaths(filepath.Dir(path))
+	}
+
+	return cfg, nil
+}
+
+// Loads the config files applying to a git repository, by decreasing precedence: the user one, then the project one (at
+// the root of its work tree)
+// The project one is committed in the repository, so it can't be trusted: unless the user config file trusts it, its
+// hosts settings can't map a remote to another host, and they can't have TLS settings.
+func loadConfigFiles(gitRepoPath string) ([]*configFile, error) {
+	cfgs := []*configFile{}
+	trustProjectHosts := false
+	if path, required := getUserConfigPath(); path != "" {
+		cfg, err := readConfigFile(path, required)
+		if err != nil {
+			return nil, err
+		}
+		cfgs = append(cfgs, cfg)
+		trustProjectHosts = cfg.TrustProjectHosts
+	}
+	if gitRepoPath != "" {
+		if workTree := gitWorkTree(gitRepoPath); workTree != "" {
+			path := filepath.Join(workTree, projectConfigFilename)
+			cfg, err := readConfigFile(path, false)
+			if err != nil {
+				return nil, err
+			}
+			if cfg.TrustProjectHosts {
+				return nil, fmt.Errorf("invalid config file '%s': trust-project-hosts is only allowed in the user config file", path)
+			}
+			for i := range cfg.Hosts {
+				if cfg.Hosts[i].tlsSettings != (tlsSettings{}) {
+					return nil, fmt.Errorf("invalid config file '%s': hosts entry %d: TLS settings are only allowed in the user config file", path, i+1)
+				}
+				cfg.Hosts[i].untrusted = !trustProjectHosts
+			}
+			cfgs = append(cfgs, cfg)
+		}
+	}
+
+	return cfgs, nil
+}
+
+// Returns the host settings of config files ordered by decreasing precedence, in this order
+func configHosts(cfgs []*configFile) []hostConfig {
+	hosts := []hostConfig{}
+	for _, cfg := range cfgs {
+		hosts = append(hosts, cfg.Hosts...)
+	}
+	return hosts
+}
+
+// Tells if the host settings apply to a host (a hostname, with a port if any), and returns the indexes of the groups of
+// its regexp match, to expand its settings
+func (host hostConfig) match(name string) (bool, []int) {
+	if host.re != nil {
+		indexes := host.re.FindStringSubmatchIndex(name)
+		return indexes != nil, indexes
+	}
+	return strings.EqualFold(host.Host, name), nil
+}
+
+// Expands the references to the groups of the host regexp in a setting value
+func (host hostConfig) expand(value string, name string, indexes []int) string {
+	if host.re == nil || indexes == nil {
+		return value
+	}
+	return string(host.re.ExpandString(nil, value, name, indexes))
+}
+
+// Returns the Gitlab root URL the first matching host settings map a Gitlab root URL guessed from a remote to
+// Returns an empty string if no host settings with an url match the host of the root URL. The untrusted settings
+// mapping it to another scheme or host are ignored.
+func mapGitlabRootURL(hosts []hostConfig, rootURL string) string {
+	u, err := url.Parse(rootURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	for _, host := range hosts {
+		if host.URL == "" {
+			continue
+		}
+		for _, name := range []string{u.Host, u.Hostname()} {
+			if matched, indexes := host.match(name); matched {
+				mappedURL := strings.TrimSuffix(host.expand(host.URL, name, indexes), "/")
+				if !strings.Contains(mappedURL, "://") {
+					mappedURL = "https://" + mappedURL
+				}
+				if host.untrusted && !isSameGitlabHost(u, mappedURL) {
+					warnUntrustedMapping(rootURL, mappedURL)
+					break
+				}
+				return mappedURL
+			}
+			if u.Port() == "" {
+				break
+			}
+		}
+	}
+
+	return ""
+}
+
+// Tells if trusted host settings, of the user config file or of a trusted project config file, apply to the host of a
+// Gitlab root URL
+func isConfiguredGitlabHost(hosts []hostConfig, rootURL string) bool {
+	u, err := url.Parse(rootURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	for _, host := range hosts {
+		if host.untrusted {
+			continue
+		}
+		if matched, _ := host.match(u.Host); matched {
+			return true
+		}
+		if matched, _ := host.match(u.Hostname()); matched && u.Port() != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tells if a mapped Gitlab root URL has the scheme and host of the root URL it maps
+func isSameGitlabHost(u *url.URL, mappedURL string) bool {
+	mapped, err := url.Parse(mappedURL)
+	return err == nil && strings.EqualFold(mapped.Scheme, u.Scheme) && strings.EqualFold(mapped.Host, u.Host)
+}
+
+// Warns once per root URL that its mapping by the project config file to another host is ignored
+func warnUntrustedMapping(rootURL string, mappedURL string) {
+	if _, warned := untrustedMappingWarnedHosts.LoadOrStore(rootURL, true); warned {
+		return
+	}
+	yellow := color.New(color.FgYellow).SprintFunc()
+	fmt.Fprintln(messageOutput, yellow(fmt.Sprintf("Mapping of '%s' to '%s' by %s ignored, as it leads to another host: "+
+		"set trust-project-hosts in the user config file to allow it", rootURL, mappedURL, projectConfigFilename)))
+}
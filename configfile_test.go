@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMapGitlabRootURL(t *testing.T) {
+	root := t.TempDir()
+	setTestHomeDir(t, filepath.Join(root, "home"))
+	t.Setenv(gitDirEnv, "")
+	t.Setenv(gitWorkTreeEnv, "")
+	userConfigPath = ""
+	t.Cleanup(func() { userConfigPath = "" })
+	createTestFiles(t, root, map[string]string{
+		"home/.config/gitlab-ci-linter/config.yml": "hosts:\n" +
+			"  - host: ssh.gitlab.example.com\n    url: https://gitlab.example.com/gitlab/\n" +
+			"  - host-regexp: '^ssh\\.(.+)$'\n    url: web.$1\n" +
+			"  - host: gitlab.local:8443\n    url: http://gitlab.local:8080\n",
+		"repo/.git/config": "[core]\n\tbare = false\n",
+		"repo/.gitlab-ci-linter.yml": "hosts:\n" +
+			"  - host: SSH.gitlab.example.com\n    url: https://project.example.com\n" +
+			"  - host: gitlab.corp.example\n    url: https://gitlab.corp.example/gitlab\n" +
+			"  - host-regexp: '.*'\n    url: https://attacker.example.com\n",
+	})
+
+	cfgs, err := loadConfigFiles(filepath.Join(root, "repo", ".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := configHosts(cfgs)
+	tests := map[string]string{
+		// The user settings have precedence
+		"https://ssh.gitlab.example.com": "https://gitlab.example.com/gitlab",
+		"https://ssh.corp.example.com":   "https://web.corp.example.com",
+		"https://gitlab.local:8443":      "http://gitlab.local:8080",
+		// The project settings can only add a relative root on the same host
+		"https://gitlab.corp.example": "https://gitlab.corp.example/gitlab",
+		"http://gitlab.corp.example":  "",
+		"https://gitlab.com":          "",
+	}
+	for rootURL, expected := range tests {
+		if mappedURL := mapGitlabRootURL(hosts, rootURL); mappedURL != expected {
+			t.Errorf("received '%s' for '%s' while expecting '%s'", mappedURL, rootURL, expected)
+		}
+	}
+
+	// The project settings can map to another host when the user settings trust them
+	createTestFiles(t, root, map[string]string{"trusting.yml": "trust-project-hosts: true\n"})
+	userConfigPath = filepath.Join(root, "trusting.yml")
+	if cfgs, err = loadConfigFiles(filepath.Join(root, "repo", ".git")); err != nil {
+		t.Fatal(err)
+	}
+	if mappedURL := mapGitlabRootURL(configHosts(cfgs), "https://gitlab.com"); mappedURL != "https://attacker.example.com" {
+		t.Errorf("received '%s' while expecting the url of the trusted project settings", mappedURL)
+	}
+	userConfigPath = ""
+
+	// User settings only, outside of a repository
+	cfgs, err = loadConfigFiles("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mappedURL := mapGitlabRootURL(configHosts(cfgs), "https://ssh.gitlab.example.com"); mappedURL != "https://gitlab.example.com/gitlab" {
+		t.Errorf("received '%s' while expecting the url of the user settings", mappedURL)
+	}
+
+	// A project config file can't trust itself
+	createTestFiles(t, root, map[string]string{"trusting/.git/config": "", "trusting/.gitlab-ci-linter.yml": "trust-project-hosts: true\n"})
+	if _, err := loadConfigFiles(filepath.Join(root, "trusting", ".git")); err == nil || !strings.Contains(err.Error(), "only allowed in the user config file") {
+		t.Errorf("received error '%v' while expecting trust-project-hosts to be rejected in a project config file", err)
+	}
+
+	// An explicitly given config file must exist, and be valid
+	createTestFiles(t, root, map[string]string{"invalid.yml": "hosts:\n  - url: https://gitlab.example.com\n"})
+	for file, expected := range map[string]string{"missing.yml": "unable to read", "invalid.yml": "must have either"} {
+		userConfigPath = filepath.Join(root, file)
+		if _, err := loadConfigFiles(""); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("received error '%v' for '%s' while expecting '%s'", err, file, expected)
+		}
+	}
+}
+
+func TestProjectHostsCannotLeakToken(t *testing.T) {
+	tokens := map[string]string{}
+	var mutex sync.Mutex
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			tokens[name] = r.Header.Get("PRIVATE-TOKEN")
+			w.WriteHeader(http.StatusNotFound)
+		}))
+	}
+	gitlab := newServer("gitlab")
+	defer gitlab.Close()
+	attacker := newServer("attacker")
+	defer attacker.Close()
+
+	root := t.TempDir()
+	setTestHomeDir(t, filepath.Join(root, "home"))
+	t.Setenv(gitDirEnv, "")
+	t.Setenv(gitWorkTreeEnv, "")
+	userConfigPath = ""
+	createTestFiles(t, root, map[string]string{
+		"repo/.git/config":           "",
+		"repo/.gitlab-ci-linter.yml": "hosts:\n  - host-regexp: '.*'\n    url: " + attacker.URL + "\n",
+	})
+	defer func(token string, attempts int64, output io.Writer) {
+		personalAccessToken, retryMaxAttempts, messageOutput = token, attempts, output
+	}(personalAccessToken, retryMaxAttempts, messageOutput)
+	personalAccessToken, retryMaxAttempts, messageOutput = "secret", 1, io.Discard
+
+	cfgs, err := loadConfigFiles(filepath.Join(root, "repo", ".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _ = guessGitlabAPIFromGitRemoteURL(gitlab.URL+"/group/app.git", configHosts(cfgs))
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if token, found := tokens["attacker"]; found {
+		t.Errorf("the host of the project settings received a request, with token '%s'", token)
+	}
+	if tokens["gitlab"] != "secret" {
+		t.Errorf("received token '%s' on the remote host while expecting 'secret'", tokens["gitlab"])
+	}
+}
@@ -21,14 +21,18 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
+	"fmt"
 	"os"
-	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/go-ini/ini"
+	"github.com/mitchellh/go-homedir"
 )
 
 // Name of the git repo directory
@@ -37,76 +41,571 @@ const gitRepoDirectory = ".git"
 // Name of the git repo config file in a git repo directory
 const gitRepoConfigFilename = "config"
 
+// Environment variables overriding the locations of the git directory and of the work tree
+const (
+	gitDirEnv      = "GIT_DIR"
+	gitWorkTreeEnv = "GIT_WORK_TREE"
+)
+
+// Prefix of the content of a '.git' file, linking a linked worktree or a submodule to its git directory
+const gitDirFilePrefix = "gitdir:"
+
 // Search in the given directory a git repository directory
 // It goes up in the filesystem hierarchy until a repository is found, or the root is reach
-// A git repository directory is a '.git' folder (gitRepoDirectory constant) containing a 'config' file
-// (gitRepoConfigFilename constant)
+// A git repository directory is a '.git' folder (gitRepoDirectory constant) whose common directory contains a
+// 'config' file (gitRepoConfigFilename constant), or the one a '.git' file links to (in linked worktrees and
+// submodules), or a bare repository. The GIT_DIR environment variable has precedence.
 func findGitRepo(directory string) (string, error) {
-	candidate := path.Join(directory, gitRepoDirectory)
+	if gitDir := os.Getenv(gitDirEnv); gitDir != "" {
+		gitDir, _ = filepath.Abs(gitDir)
+		if !isGitDirectory(gitDir) {
+			return "", fmt.Errorf("'%s' given by %s is not a git repository", gitDir, gitDirEnv)
+		}
+		return gitDir, nil
+	}
 
-	fileInfo, err := os.Stat(candidate)
-	if !os.IsNotExist(err) && fileInfo.IsDir() {
-		// Found a git directory, check of it has a config file
-		fileInfo, err = os.Stat(path.Join(candidate, gitRepoConfigFilename))
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return "", err
+	}
+
+	return searchGitRepo(directory)
+}
+
+func searchGitRepo(directory string) (string, error) {
+	candidate := filepath.Join(directory, gitRepoDirectory)
 
-		if !os.IsNotExist(err) && !fileInfo.IsDir() {
-			return candidate, nil
+	fileInfo, err := os.Stat(candidate)
+	if err == nil && fileInfo.IsDir() && isGitDirectory(candidate) {
+		return candidate, nil
+	}
+	if err == nil && !fileInfo.IsDir() {
+		// Linked worktree or submodule: the '.git' file gives the git directory
+		if gitDir, err := readGitDirFile(candidate); err == nil && isGitDirectory(gitDir) {
+			return gitDir, nil
 		}
 	}
 
+	if isBareGitRepository(directory) {
+		return directory, nil
+	}
+
 	// If we are at the root of the filesystem, it means we did not find any gitlab-ci file
 	if directory[len(directory)-1] == filepath.Separator {
 		return "", errors.New("not found")
 	}
 
-	return findGitRepo(filepath.Dir(directory))
+	return searchGitRepo(filepath.Dir(directory))
+}
+
+// Reads a '.git' file, containing "gitdir: <path>", and returns the absolute path of the git directory it links to
+func readGitDirFile(gitFile string) (string, error) {
+	content, err := os.ReadFile(gitFile) // #nosec G304
+	if err != nil {
+		return "", err
+	}
+	gitDir, found := strings.CutPrefix(strings.TrimSpace(string(content)), gitDirFilePrefix)
+	if !found {
+		return "", fmt.Errorf("invalid git file '%s'", gitFile)
+	}
+
+	return resolveGitPath(filepath.Dir(gitFile), strings.TrimSpace(gitDir)), nil
+}
+
+// Returns a path read in a git file, that can be relative to the given directory, as an absolute path
+func resolveGitPath(directory string, gitPath string) string {
+	gitPath = filepath.FromSlash(gitPath)
+	if !filepath.IsAbs(gitPath) {
+		gitPath = filepath.Join(directory, gitPath)
+	}
+	return filepath.Clean(gitPath)
+}
+
+// Tells if a directory is a git directory: its common directory contains a config file
+func isGitDirectory(gitDir string) bool {
+	fileInfo, err := os.Stat(filepath.Join(gitCommonDir(gitDir), gitRepoConfigFilename))
+	return err == nil && !fileInfo.IsDir()
+}
+
+// Tells if a directory is a bare git repository: a git directory with a HEAD file and an objects directory
+func isBareGitRepository(directory string) bool {
+	if !isGitDirectory(directory) {
+		return false
+	}
+	headInfo, err := os.Stat(filepath.Join(directory, "HEAD"))
+	if err != nil || headInfo.IsDir() {
+		return false
+	}
+	objectsInfo, err := os.Stat(filepath.Join(directory, "objects"))
+	return err == nil && objectsInfo.IsDir()
+}
+
+// Returns the common directory of a git directory: the main git directory for a linked worktree, where the config,
+// the objects, the refs and the hooks are shared. For other repositories, it is the git directory itself.
+func gitCommonDir(gitDir string) string {
+	content, err := os.ReadFile(filepath.Join(gitDir, "commondir")) // #nosec G304
+	if err != nil {
+		return gitDir
+	}
+	return resolveGitPath(gitDir, strings.TrimSpace(string(content)))
+}
+
+// Returns the work tree of a git directory, or an empty string for a bare repository
+// The GIT_WORK_TREE environment variable has precedence, then the location of the '.git' file of a linked worktree,
+// then the core.worktree setting (used by submodules).
+func gitWorkTree(gitDir string) string {
+	if workTree := os.Getenv(gitWorkTreeEnv); workTree != "" {
+		workTree, _ = filepath.Abs(workTree)
+		return workTree
+	}
+
+	if content, err := os.ReadFile(filepath.Join(gitDir, "gitdir")); err == nil { // #nosec G304
+		return filepath.Dir(resolveGitPath(gitDir, strings.TrimSpace(string(content))))
+	}
+
+	cfg, err := loadGitCfg(gitDir)
+	if err == nil {
+		cfgs := []*ini.File{cfg}
+		if workTree, _ := gitCfgValue(cfgs, "core", "worktree"); workTree != "" {
+			return resolveGitPath(gitDir, workTree)
+		}
+		if bare, _ := gitCfgValue(cfgs, "core", "bare"); parseGitBool(bare) {
+			return ""
+		}
+	}
+
+	return filepath.Dir(gitDir)
+}
+
+// Search the git repository of a file: first from the file location, then from directoryRoot
+// Returns an empty string if no repository is found
+func findGitRepoOfFile(filePath string) string {
+	gitRepoPath, err := findGitRepo(filepath.Dir(filePath))
+	if err != nil {
+		gitRepoPath, _ = findGitRepo(directoryRoot)
+	}
+	return gitRepoPath
 }
 
-// Load git config file from git repository directory
+// Options to parse git config files: keys without value are booleans, and keys can have several values
+var gitCfgLoadOptions = ini.LoadOptions{AllowBooleanKeys: true, AllowShadows: true}
+
+// Maximum depth of nested git config includes, as for git
+const maxGitCfgIncludeDepth = 10
+
+// Load git config file from git repository directory (from its common directory, for a linked worktree)
 func loadGitCfg(gitDirectory string) (*ini.File, error) {
-	cfg, err := ini.Load(path.Join(gitDirectory, gitRepoConfigFilename))
+	return loadGitCfgFile(filepath.Join(gitCommonDir(gitDirectory), gitRepoConfigFilename), gitDirectory)
+}
+
+// Loads a git config file with the files it includes, applied at the place of their include directive as git does: the
+// keys declared after the directive have precedence over the included ones.
+// gitDirectory is the repository the configuration applies to, for the conditional includes.
+func loadGitCfgFile(cfgPath string, gitDirectory string) (*ini.File, error) {
+	sources, err := gitCfgSources(cfgPath, gitDirectory, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return ini.Empty(gitCfgLoadOptions), nil
+	}
+	others := make([]any, 0, len(sources)-1)
+	for _, source := range sources[1:] {
+		others = append(others, source)
+	}
+	return ini.LoadSources(gitCfgLoadOptions, sources[0], others...)
+}
+
+// Returns the contents of a git config file and of the files it includes, recursively, by increasing precedence: the
+// file is split after each include directive, and the included files are inserted there. Included files that are
+// missing or invalid are ignored, as git does.
+func gitCfgSources(cfgPath string, gitDirectory string, depth int) ([][]byte, error) {
+	content, err := os.ReadFile(cfgPath) // #nosec G304
 	if err != nil {
 		return nil, err
 	}
+	if _, err := ini.LoadSources(gitCfgLoadOptions, content); err != nil {
+		return nil, err
+	}
+
+	sources := [][]byte{}
+	pending := []byte{}
+	for _, chunk := range splitGitCfgSections(content) {
+		pending = append(pending, chunk...)
+		if depth >= maxGitCfgIncludeDepth {
+			continue
+		}
+		includePaths := gitCfgIncludePaths(chunk, cfgPath, gitDirectory)
+		if len(includePaths) == 0 {
+			continue
+		}
+		sources = append(sources, pending)
+		pending = []byte{}
+		for _, includePath := range includePaths {
+			if included, err := gitCfgSources(includePath, gitDirectory, depth+1); err == nil {
+				sources = append(sources, included...)
+			}
+		}
+	}
+	if len(pending) > 0 {
+		sources = append(sources, pending)
+	}
 
-	return cfg, nil
+	return sources, nil
 }
 
-// Extract the origin remote url from a git config file
-func getGitOriginRemoteURL(gitDirectory string) (string, error) {
-	cfg, err := loadGitCfg(gitDirectory)
+// Splits the content of a git config file before each section header
+func splitGitCfgSections(content []byte) [][]byte {
+	chunks := [][]byte{}
+	start := 0
+	for offset := 0; offset < len(content); {
+		end := bytes.IndexByte(content[offset:], '\n')
+		if end < 0 {
+			end = len(content)
+		} else {
+			end += offset + 1
+		}
+		if offset > start && bytes.HasPrefix(bytes.TrimSpace(content[offset:end]), []byte("[")) {
+			chunks = append(chunks, content[start:offset])
+			start = offset
+		}
+		offset = end
+	}
+	return append(chunks, content[start:])
+}
+
+// Returns the paths of the files included by the include directive starting a chunk of a git config file, if it applies
+// to the given repository
+func gitCfgIncludePaths(chunk []byte, cfgPath string, gitDirectory string) []string {
+	cfg, err := ini.LoadSources(gitCfgLoadOptions, chunk)
+	if err != nil {
+		return nil
+	}
+
+	paths := []string{}
+	for _, section := range cfg.Sections() {
+		if !isGitCfgIncludeApplying(section.Name(), cfgPath, gitDirectory) {
+			continue
+		}
+		for _, key := range section.Keys() {
+			if !strings.EqualFold(key.Name(), "path") {
+				continue
+			}
+			for _, includePath := range key.ValueWithShadows() {
+				includePath, err = homedir.Expand(includePath)
+				if err != nil || includePath == "" {
+					continue
+				}
+				if !filepath.IsAbs(includePath) {
+					includePath = filepath.Join(filepath.Dir(cfgPath), includePath)
+				}
+				paths = append(paths, includePath)
+			}
+		}
+	}
+
+	return paths
+}
+
+// Tells if a git config section is an include directive whose files apply to the given repository: an [include]
+// section, or an [includeIf "<condition>"] one whose gitdir:, gitdir/i: or onbranch: condition is met
+func isGitCfgIncludeApplying(sectionName string, cfgPath string, gitDirectory string) bool {
+	if strings.EqualFold(sectionName, "include") {
+		return true
+	}
+	if len(sectionName) < len(`includeIf ""`) || !strings.EqualFold(sectionName[:len(`includeIf "`)], `includeIf "`) ||
+		!strings.HasSuffix(sectionName, `"`) {
+		return false
+	}
+	condition := sectionName[len(`includeIf "`) : len(sectionName)-1]
+
+	if pattern, found := strings.CutPrefix(condition, "gitdir:"); found {
+		return matchGitCfgGitdir(pattern, cfgPath, gitDirectory, false)
+	}
+	if pattern, found := strings.CutPrefix(condition, "gitdir/i:"); found {
+		return matchGitCfgGitdir(pattern, cfgPath, gitDirectory, true)
+	}
+	if pattern, found := strings.CutPrefix(condition, "onbranch:"); found {
+		branch, err := GetCurrentBranch(gitDirectory)
+		if err != nil || branch == "" {
+			return false
+		}
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		return matchGitCfgPattern(pattern, branch, false)
+	}
+
+	return false
+}
+
+// Tells if the git directory of a repository matches the pattern of a gitdir: include condition
+// As for git, "~/" is the home directory, "./" the directory of the including file, a pattern not starting with "/"
+// matches at any depth, and a pattern ending with "/" matches everything inside it.
+func matchGitCfgGitdir(pattern string, cfgPath string, gitDirectory string, foldCase bool) bool {
+	if rest, found := strings.CutPrefix(pattern, "~/"); found {
+		home, err := homedir.Dir()
+		if err != nil {
+			return false
+		}
+		pattern = filepath.ToSlash(home) + "/" + rest
+	} else if rest, found := strings.CutPrefix(pattern, "./"); found {
+		pattern = filepath.ToSlash(filepath.Dir(cfgPath)) + "/" + rest
+	}
+	if !strings.HasPrefix(pattern, "/") && !filepath.IsAbs(pattern) {
+		pattern = "**/" + pattern
+	}
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+
+	candidates := []string{gitDirectory}
+	if resolved, err := filepath.EvalSymlinks(gitDirectory); err == nil && resolved != gitDirectory {
+		candidates = append(candidates, resolved)
+	}
+	for _, candidate := range candidates {
+		if matchGitCfgPattern(pattern, filepath.ToSlash(candidate), foldCase) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tells if a value matches the glob pattern of an include condition
+func matchGitCfgPattern(pattern string, value string, foldCase bool) bool {
+	re, err := includeGlobToRegexp(pattern)
 	if err != nil {
+		return false
+	}
+	if foldCase {
+		if re, err = regexp.Compile("(?i)" + re.String()); err != nil {
+			return false
+		}
+	}
+	return re.MatchString(value)
+}
+
+// Returns the paths of the global git config files, by increasing precedence: the XDG one
+// ($XDG_CONFIG_HOME/git/config, or ~/.config/git/config), then ~/.gitconfig
+func globalGitCfgPaths() []string {
+	paths := []string{}
+	home, err := homedir.Dir()
+	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
+		paths = append(paths, filepath.Join(xdgConfigHome, "git", "config"))
+	} else if err == nil {
+		paths = append(paths, filepath.Join(home, ".config", "git", "config"))
+	}
+	if err == nil {
+		paths = append(paths, filepath.Join(home, ".gitconfig"))
+	}
+
+	return paths
+}
+
+// Loads the git config files applying to a repository, by increasing precedence: the global ones, then the repository
+// one. Missing or invalid files are ignored.
+func loadGitCfgs(gitDirectory string) []*ini.File {
+	cfgs := []*ini.File{}
+	for _, path := range globalGitCfgPaths() {
+		if cfg, err := loadGitCfgFile(path, gitDirectory); err == nil {
+			cfgs = append(cfgs, cfg)
+		}
+	}
+	if cfg, err := loadGitCfg(gitDirectory); err == nil {
+		cfgs = append(cfgs, cfg)
+	}
+
+	return cfgs
+}
+
+// Returns the values of a git config key from config files ordered by increasing precedence
+// Section and key names are case-insensitive, as for git.
+func gitCfgValues(cfgs []*ini.File, sectionName string, keyName string) []string {
+	values := []string{}
+	for _, cfg := range cfgs {
+		for _, section := range cfg.Sections() {
+			if !strings.EqualFold(section.Name(), sectionName) {
+				continue
+			}
+			for _, key := range section.Keys() {
+				if strings.EqualFold(key.Name(), keyName) {
+					values = append(values, key.ValueWithShadows()...)
+				}
+			}
+		}
+	}
+
+	return values
+}
+
+// Returns the value of a git config key from config files ordered by increasing precedence, and tells if it is set
+// Section and key names are case-insensitive, as for git, and the last value wins.
+func gitCfgValue(cfgs []*ini.File, sectionName string, keyName string) (string, bool) {
+	values := gitCfgValues(cfgs, sectionName, keyName)
+	if len(values) == 0 {
+		return "", false
+	}
+
+	return values[len(values)-1], true
+}
+
+// Tells if a git config boolean value is true
+func parseGitBool(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "on", "1":
+		return true
+	}
+	return false
+}
+
+// Rewrites a git url with the url.<base>.insteadOf settings of config files: the base with the longest matching prefix
+// replaces it. For a push url, url.<base>.pushInsteadOf settings have precedence over insteadOf ones.
+func rewriteGitURL(cfgs []*ini.File, url string, push bool) string {
+	keys := []string{"insteadOf"}
+	if push {
+		keys = []string{"pushInsteadOf", "insteadOf"}
+	}
+
+	for _, keyName := range keys {
+		base, prefix := "", ""
+		for _, cfg := range cfgs {
+			for _, section := range cfg.Sections() {
+				name := section.Name()
+				if len(name) < len(`url ""`) || !strings.EqualFold(name[:len(`url "`)], `url "`) ||
+					!strings.HasSuffix(name, `"`) {
+					continue
+				}
+				for _, candidate := range gitCfgValues([]*ini.File{cfg}, name, keyName) {
+					if strings.HasPrefix(url, candidate) && len(candidate) > len(prefix) {
+						base, prefix = name[len(`url "`):len(name)-1], candidate
+					}
+				}
+			}
+		}
+		if prefix != "" {
+			return base + strings.TrimPrefix(url, prefix)
+		}
+	}
+
+	return url
+}
+
+// Extract the url of a remote from the git config files, rewritten by the insteadOf settings
+// Returns an empty string if the remote does not exist.
+func getGitRemoteURL(gitDirectory string, name string) (string, error) {
+	if _, err := loadGitCfg(gitDirectory); err != nil {
 		return "", err
 	}
+	cfgs := loadGitCfgs(gitDirectory)
 
-	remote, err := cfg.GetSection("remote \"origin\"")
-	if err == nil && remote.HasKey("url") {
-		return remote.Key("url").String(), nil
+	url, found := gitCfgValue(cfgs, "remote \""+name+"\"", "url")
+	if !found {
+		return "", nil
 	}
 
-	return "", nil
+	return rewriteGitURL(cfgs, url, false), nil
+}
+
+// Extract the push url of a remote from the git config files: its pushurl rewritten by the insteadOf settings, or its
+// url rewritten by the pushInsteadOf or insteadOf settings
+// Returns an empty string if the remote does not exist.
+func getGitRemotePushURL(gitDirectory string, name string) (string, error) {
+	if _, err := loadGitCfg(gitDirectory); err != nil {
+		return "", err
+	}
+	cfgs := loadGitCfgs(gitDirectory)
+
+	if pushURL, found := gitCfgValue(cfgs, "remote \""+name+"\"", "pushurl"); found {
+		return rewriteGitURL(cfgs, pushURL, false), nil
+	}
+	url, found := gitCfgValue(cfgs, "remote \""+name+"\"", "url")
+	if !found {
+		return "", nil
+	}
+
+	return rewriteGitURL(cfgs, url, true), nil
+}
+
+// Returns the names of the remotes of a git config file, in their order of declaration
+func getGitRemoteNames(gitDirectory string) ([]string, error) {
+	cfg, err := loadGitCfg(gitDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, section := range cfg.Sections() {
+		name, found := strings.CutPrefix(section.Name(), "remote \"")
+		if !found || !strings.HasSuffix(name, "\"") || !section.HasKey("url") {
+			continue
+		}
+		if name = strings.TrimSuffix(name, "\""); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// Returns the name of the remote the current branch tracks (its upstream), or an empty string if there is none
+func getGitBranchUpstreamRemote(gitDirectory string) string {
+	branch, err := GetCurrentBranch(gitDirectory)
+	if err != nil || branch == "" {
+		return ""
+	}
+	cfg, err := loadGitCfg(gitDirectory)
+	if err != nil {
+		return ""
+	}
+
+	remote, _ := gitCfgValue([]*ini.File{cfg}, "branch \""+branch+"\"", "remote")
+	// "." means that the upstream is a local branch
+	if remote == "." {
+		return ""
+	}
+	return remote
 }
 
 // Transform a git remote url, that can be a full http ou ssh url, to a simple http FQDN host
 // Returns the root URL, and the project path.
 // e.g.: a remote "https://gitlab.com/orobardet/gitlab-ci-linter.git" or
 // "git@gitlab.com:orobardet/gitlab-ci-linter.git" will both returns "https://gitlab.com", "orobardet/gitlab-ci-linter"
+// For ssh remotes ("ssh://[user@]host[:port]/path" or "[user@]host:path"), the host aliases of the ssh config are
+// resolved, the ssh port is ignored, and a "~user/" (or "~/") path prefix is removed.
 func parseGitRemoteURL(remoteURL string) (string, string) {
-	re := regexp.MustCompile(`^(https?://[^/]*)(.*?)(?:\.git)?$`)
+	re := regexp.MustCompile(`^(https?://[^/]*)(.*?)(?:\.git)?/?$`)
 	if re.MatchString(remoteURL) { // http remote
 		matches := re.FindStringSubmatch(remoteURL)
 		if len(matches) >= 2 {
 			return matches[1], strings.TrimLeft(matches[2], "/")
 		}
-	} else { // ssh remote
-		re = regexp.MustCompile(`^([^@]*@)?([^:]+):(.*?)(?:\.git)?$`)
+	}
+
+	var host, path string
+	re = regexp.MustCompile(`^(?:ssh|git\+ssh|ssh\+git)://(?:[^@/]*@)?(\[[^\]]*\]|[^:/]+)(?::\d*)?(/.*)?$`)
+	if matches := re.FindStringSubmatch(remoteURL); matches != nil { // ssh url remote
+		host, path = strings.Trim(matches[1], "[]"), matches[2]
+	} else { // scp-like ssh remote
+		re = regexp.MustCompile(`^(?:[^@/]*@)?(\[[^\]]*\]|[^:/]+):(.*)$`)
 		matches := re.FindStringSubmatch(remoteURL)
-		if len(matches) >= 3 {
-			return "https://" + matches[2], strings.TrimLeft(matches[3], "/")
+		if matches == nil {
+			return "", ""
 		}
+		host, path = strings.Trim(matches[1], "[]"), matches[2]
 	}
 
-	return "", ""
+	path = strings.TrimLeft(path, "/")
+	if strings.HasPrefix(path, "~") {
+		// "~user/path" is relative to the home of the user, whose name is also the Gitlab namespace
+		path = strings.TrimLeft(strings.TrimPrefix(path, "~"), "/")
+	}
+	path = strings.TrimSuffix(strings.TrimRight(path, "/"), ".git")
+
+	host = resolveSSHHostAlias(host)
+	if strings.Contains(host, ":") { // IPv6 address
+		host = "[" + host + "]"
+	}
+	return "https://" + host, path
 }
 
 // GetCurrentBranch returns the current branch name of the git repository by reading the .git/HEAD file.
@@ -124,3 +623,56 @@ func GetCurrentBranch(gitDirectory string) (string, error) {
 
 	return "", nil
 }
+
+// Maximum number of symbolic references followed to resolve a git reference
+const maxGitSymbolicRefDepth = 10
+
+// Resolves a git reference (e.g. "HEAD" or "refs/heads/main") to an object hash, following symbolic references
+// Loose references have precedence over packed ones. An empty hash is returned for a reference that does not exist
+// yet, like the branch of a repository without any commit.
+func resolveGitRef(gitDirectory string, ref string) (string, error) {
+	for range maxGitSymbolicRefDepth {
+		// Only HEAD and a few refs are specific to a linked worktree, the other ones are shared
+		refDirectory := gitCommonDir(gitDirectory)
+		if !strings.Contains(ref, "/") || strings.HasPrefix(ref, "refs/worktree/") || strings.HasPrefix(ref, "refs/bisect/") {
+			refDirectory = gitDirectory
+		}
+		content, err := os.ReadFile(filepath.Join(refDirectory, filepath.FromSlash(ref))) // #nosec G304
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+			return findGitPackedRef(gitDirectory, ref)
+		}
+		value := strings.TrimSpace(string(content))
+		if !strings.HasPrefix(value, "ref: ") {
+			return value, nil
+		}
+		ref = strings.TrimPrefix(value, "ref: ")
+	}
+
+	return "", fmt.Errorf("too many levels of symbolic references for '%s'", ref)
+}
+
+// Looks for a reference in the packed-refs file of a git repository, and returns its hash, or an empty string if
+// the reference is not found
+func findGitPackedRef(gitDirectory string, ref string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(gitCommonDir(gitDirectory), "packed-refs")) // #nosec G304
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// Lines are "<hash> <ref>", comments start with '#' and peeled tags with '^'
+		hash, name, found := strings.Cut(scanner.Text(), " ")
+		if found && name == ref {
+			return hash, nil
+		}
+	}
+
+	return "", scanner.Err()
+}
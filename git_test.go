@@ -21,7 +21,13 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+
+	"github.com/go-ini/ini"
+	"github.com/mitchellh/go-homedir"
 )
 
 var httpiseRemoteURLData = [][]string{
@@ -47,6 +53,8 @@ var httpiseRemoteURLData = [][]string{
 }
 
 func TestHttpiseRemoteUrl(t *testing.T) {
+	// Isolated from the ssh config of the user
+	setTestHomeDir(t, t.TempDir())
 
 	for _, testData := range httpiseRemoteURLData {
 		params := testData[0]
@@ -63,3 +71,208 @@ func TestHttpiseRemoteUrl(t *testing.T) {
 		})
 	}
 }
+
+// Creates files with their content in a directory, for repository layout tests
+func createTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		fullPath := filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Sets the home directory, without any global git config, for the duration of a test
+func setTestHomeDir(t *testing.T, home string) {
+	t.Helper()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+}
+
+func TestGitRepositoryLayouts(t *testing.T) {
+	root := t.TempDir()
+	originConfig := "[core]\n\tbare = false\n[remote \"origin\"]\n\turl = git@gitlab.com:my/project.git\n"
+	createTestFiles(t, root, map[string]string{
+		// Main work tree
+		"main/.git/config":  originConfig,
+		"main/.git/HEAD":    "ref: refs/heads/main\n",
+		"main/src/file.txt": "",
+		// Linked worktree of the main repository
+		"main/.git/worktrees/feature/HEAD":      "ref: refs/heads/feature\n",
+		"main/.git/worktrees/feature/commondir": "../..\n",
+		"main/.git/worktrees/feature/gitdir":    filepath.Join(root, "feature", ".git") + "\n",
+		"feature/.git":                          "gitdir: " + filepath.Join(root, "main", ".git", "worktrees", "feature") + "\n",
+		"feature/src/file.txt":                  "",
+		// Submodule of the main repository
+		"main/.git/modules/lib/config": "[core]\n\tworktree = ../../../lib\n[remote \"origin\"]\n\turl = https://gitlab.com/my/lib.git\n",
+		"main/.git/modules/lib/HEAD":   "ref: refs/heads/develop\n",
+		"main/lib/.git":                "gitdir: ../.git/modules/lib\n",
+		// Bare repository
+		"bare.git/config":             "[core]\n\tbare = true\n[remote \"origin\"]\n\turl = https://gitlab.com/my/bare.git\n",
+		"bare.git/HEAD":               "ref: refs/heads/master\n",
+		"bare.git/objects/info/packs": "",
+	})
+
+	data := []struct {
+		directory string
+		gitDir    string
+		workTree  string
+		branch    string
+		remoteURL string
+		hooksDir  string
+	}{
+		{"main/src", "main/.git", "main", "main", "git@gitlab.com:my/project.git", "main/.git/hooks"},
+		{"feature/src", "main/.git/worktrees/feature", "feature", "feature", "git@gitlab.com:my/project.git", "main/.git/hooks"},
+		{"main/lib", "main/.git/modules/lib", "main/lib", "develop", "https://gitlab.com/my/lib.git", "main/.git/modules/lib/hooks"},
+		{"bare.git/objects", "bare.git", "", "master", "https://gitlab.com/my/bare.git", "bare.git/hooks"},
+	}
+	t.Setenv(gitDirEnv, "")
+	t.Setenv(gitWorkTreeEnv, "")
+	setTestHomeDir(t, t.TempDir())
+	for _, testData := range data {
+		t.Run("directory="+testData.directory, func(t *testing.T) {
+			gitDir, err := findGitRepo(filepath.Join(root, testData.directory))
+			if err != nil {
+				t.Fatalf("received error '%s' while expecting none", err)
+			}
+			if expected := filepath.Join(root, testData.gitDir); gitDir != expected {
+				t.Errorf("received git directory '%s' while expecting '%s'", gitDir, expected)
+			}
+			expectedWorkTree := ""
+			if testData.workTree != "" {
+				expectedWorkTree = filepath.Join(root, testData.workTree)
+			}
+			if workTree := gitWorkTree(gitDir); workTree != expectedWorkTree {
+				t.Errorf("received work tree '%s' while expecting '%s'", workTree, expectedWorkTree)
+			}
+			if branch, _ := GetCurrentBranch(gitDir); branch != testData.branch {
+				t.Errorf("received branch '%s' while expecting '%s'", branch, testData.branch)
+			}
+			if remoteURL, _ := getGitRemoteURL(gitDir, "origin"); remoteURL != testData.remoteURL {
+				t.Errorf("received remote URL '%s' while expecting '%s'", remoteURL, testData.remoteURL)
+			}
+			if hooksDir := gitHooksDir(gitDir); hooksDir != filepath.Join(root, testData.hooksDir) {
+				t.Errorf("received hooks directory '%s' while expecting '%s'", hooksDir, filepath.Join(root, testData.hooksDir))
+			}
+		})
+	}
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv(gitDirEnv, filepath.Join(root, "main", ".git"))
+		t.Setenv(gitWorkTreeEnv, filepath.Join(root, "feature"))
+		gitDir, err := findGitRepo(root)
+		if err != nil || gitDir != filepath.Join(root, "main", ".git") {
+			t.Errorf("received git directory '%s' (error %v) while expecting the one of %s", gitDir, err, gitDirEnv)
+		}
+		if workTree := gitWorkTree(gitDir); workTree != filepath.Join(root, "feature") {
+			t.Errorf("received work tree '%s' while expecting the one of %s", workTree, gitWorkTreeEnv)
+		}
+	})
+}
+
+func TestGitHooksDir(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, "home")
+	setTestHomeDir(t, home)
+	t.Setenv(gitDirEnv, "")
+	t.Setenv(gitWorkTreeEnv, "")
+	createTestFiles(t, root, map[string]string{
+		"repo/.git/config":            "[core]\n\tbare = false\n",
+		"home/.config/git/config":     "[core]\n\thooksPath = ~/xdg-hooks\n",
+		"other/.git/config":           "[core]\n\thooksPath = .githooks\n",
+		"bare.git/config":             "[core]\n\tbare = true\n\thookspath = hooks-dir\n",
+		"bare.git/HEAD":               "ref: refs/heads/main\n",
+		"bare.git/objects/info/packs": "",
+	})
+	gitDir := filepath.Join(root, "repo", ".git")
+
+	// XDG config
+	if hooksDir := gitHooksDir(gitDir); hooksDir != filepath.Join(home, "xdg-hooks") {
+		t.Errorf("received hooks directory '%s' while expecting the one of the XDG config", hooksDir)
+	}
+
+	// ~/.gitconfig has precedence over the XDG config
+	createTestFiles(t, home, map[string]string{".gitconfig": "[core]\n\thooksPath = /global/hooks\n"})
+	if hooksDir := gitHooksDir(gitDir); hooksDir != filepath.Clean("/global/hooks") {
+		t.Errorf("received hooks directory '%s' while expecting the one of ~/.gitconfig", hooksDir)
+	}
+
+	// Repository config has precedence, and a relative path is relative to the work tree (or git directory if bare)
+	if hooksDir := gitHooksDir(filepath.Join(root, "other", ".git")); hooksDir != filepath.Join(root, "other", ".githooks") {
+		t.Errorf("received hooks directory '%s' while expecting the one of the repository config", hooksDir)
+	}
+	if hooksDir := gitHooksDir(filepath.Join(root, "bare.git")); hooksDir != filepath.Join(root, "bare.git", "hooks-dir") {
+		t.Errorf("received hooks directory '%s' while expecting the one of the bare repository config", hooksDir)
+	}
+}
+
+func TestGitCfgIncludes(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, "home")
+	setTestHomeDir(t, home)
+	t.Setenv(gitDirEnv, "")
+	t.Setenv(gitWorkTreeEnv, "")
+	createTestFiles(t, root, map[string]string{
+		"home/.gitconfig": "[includeIf \"gitdir:~/work/\"]\n\tpath = .gitconfig-work\n" +
+			"[includeIf \"gitdir/i:/NOWHERE/\"]\n\tpath = .gitconfig-nowhere\n",
+		"home/.gitconfig-work":    "[url \"https://gitlab.example.com/\"]\n\tinsteadOf = work:\n",
+		"home/.gitconfig-nowhere": "[url \"https://nowhere.example.com/\"]\n\tinsteadOf = work:\n",
+		"home/work/app/.git/config": "[include]\n\tpath = ../remotes.cfg\n\tpath = missing.cfg\n" +
+			"[remote \"origin\"]\n\turl = work:group/app.git\n" +
+			"[include]\n\tpath = ../late.cfg\n",
+		"home/work/app/remotes.cfg": "[remote \"upstream\"]\n\turl = git@gitlab.com:group/app.git\n" +
+			"[remote \"origin\"]\n\turl = work:group/defaults.git\n",
+		"home/work/app/late.cfg": "[remote \"upstream\"]\n\turl = git@gitlab.com:group/late.git\n",
+		"other/.git/config":      "[remote \"origin\"]\n\turl = work:group/other.git\n",
+	})
+
+	gitDir := filepath.Join(home, "work", "app", ".git")
+	if names, _ := getGitRemoteNames(gitDir); !reflect.DeepEqual(names, []string{"upstream", "origin"}) {
+		t.Errorf("received remotes %v while expecting the included one too, in declaration order", names)
+	}
+	if url, _ := getGitRemoteURL(gitDir, "origin"); url != "https://gitlab.example.com/group/app.git" {
+		t.Errorf("received url '%s' while expecting the one declared after the include, rewritten by the conditionally included config", url)
+	}
+	if url, _ := getGitRemoteURL(gitDir, "upstream"); url != "git@gitlab.com:group/late.git" {
+		t.Errorf("received url '%s' while expecting the one of the file included last", url)
+	}
+	if url, _ := getGitRemoteURL(filepath.Join(root, "other", ".git"), "origin"); url != "work:group/other.git" {
+		t.Errorf("received url '%s' while expecting it unchanged outside of the included gitdir", url)
+	}
+}
+
+func TestRewriteGitURL(t *testing.T) {
+	cfg, err := ini.LoadSources(gitCfgLoadOptions, []byte(
+		"[url \"https://gitlab.com/\"]\n\tinsteadOf = gl:\n\tinsteadOf = git@gitlab.com:\n"+
+			"[url \"https://gitlab.com/mirror/\"]\n\tinsteadOf = gl:group/\n"+
+			"[url \"git@gitlab.com:\"]\n\tpushInsteadOf = https://gitlab.com/\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfgs := []*ini.File{cfg}
+
+	tests := []struct {
+		url      string
+		push     bool
+		expected string
+	}{
+		{"gl:group/app.git", false, "https://gitlab.com/mirror/app.git"},
+		{"gl:other/app.git", false, "https://gitlab.com/other/app.git"},
+		{"git@gitlab.com:group/app.git", false, "https://gitlab.com/group/app.git"},
+		{"https://gitlab.com/group/app.git", false, "https://gitlab.com/group/app.git"},
+		{"https://gitlab.com/group/app.git", true, "git@gitlab.com:group/app.git"},
+		{"gl:other/app.git", true, "https://gitlab.com/other/app.git"},
+	}
+	for _, test := range tests {
+		if url := rewriteGitURL(cfgs, test.url, test.push); url != test.expected {
+			t.Errorf("received '%s' for '%s' (push: %v) while expecting '%s'", url, test.url, test.push, test.expected)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// A rule of a .gitignore file
+type gitignoreRule struct {
+	// Directory of the .gitignore file, relative to the work tree ("" for the root)
+	base     string
+	re       *regexp.Regexp
+	negate   bool
+	dirOnly  bool
+	basename bool
+}
+
+// Matcher of the paths ignored by the .gitignore files of a work tree
+// Rules are added while walking down the work tree; the last matching rule wins, so deeper files have precedence.
+type gitignoreMatcher struct {
+	rules []gitignoreRule
+}
+
+// Parses a line of a .gitignore file, and returns the corresponding rule
+// Returns false for blank lines, comments, and invalid patterns.
+func parseGitignoreLine(line string, base string) (gitignoreRule, bool) {
+	if !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line, " \t\r")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gitignoreRule{}, false
+	}
+
+	rule := gitignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// A pattern without any slash (but a trailing one) matches at any depth
+	rule.basename = !strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return gitignoreRule{}, false
+	}
+
+	re, err := includeGlobToRegexp(strings.ReplaceAll(line, `\ `, " "))
+	if err != nil {
+		return gitignoreRule{}, false
+	}
+	rule.re = re
+
+	return rule, true
+}
+
+// Loads the rules of an ignore file, whose patterns are relative to the given base directory of the work tree
+// A missing file is not an error.
+func (matcher *gitignoreMatcher) load(ignoreFile string, base string) error {
+	content, err := os.ReadFile(ignoreFile) // #nosec G304
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if rule, ok := parseGitignoreLine(scanner.Text(), base); ok {
+			matcher.rules = append(matcher.rules, rule)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Tells if a path of the work tree (slash separated, relative to the work tree root) is ignored
+func (matcher *gitignoreMatcher) ignored(relativePath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range matcher.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		candidate := relativePath
+		if rule.base != "" {
+			var found bool
+			if candidate, found = strings.CutPrefix(relativePath, rule.base+"/"); !found {
+				continue
+			}
+		}
+		if rule.basename {
+			candidate = path.Base(candidate)
+		}
+		if rule.re.MatchString(candidate) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+// Returns the path of the user excludes file applying to a repository: core.excludesFile, or
+// $XDG_CONFIG_HOME/git/ignore (~/.config/git/ignore by default). Returns an empty string if there is none.
+func gitExcludesFilePath(gitRepoPath string) string {
+	if excludesFile, found := gitCfgValue(loadGitCfgs(gitRepoPath), "core", "excludesfile"); found {
+		if excludesFile == "" {
+			return ""
+		}
+		excludesFile, err := homedir.Expand(excludesFile)
+		if err != nil {
+			return ""
+		}
+		return excludesFile
+	}
+	if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
+		return filepath.Join(xdgConfigHome, "git", "ignore")
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "git", "ignore")
+}
+
+// Creates a matcher of the ignored files of a work tree, with the user and repository exclude files and the .gitignore
+// files from the work tree root down to the given directory (excluded), by increasing precedence
+func newGitignoreMatcher(workTree string, gitRepoPath string, directory string) (*gitignoreMatcher, error) {
+	matcher := &gitignoreMatcher{}
+	if gitRepoPath != "" {
+		if excludesFile := gitExcludesFilePath(gitRepoPath); excludesFile != "" {
+			if err := matcher.load(excludesFile, ""); err != nil {
+				return nil, err
+			}
+		}
+		if err := matcher.load(filepath.Join(gitCommonDir(gitRepoPath), "info", "exclude"), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	relativeDirectory, err := filepath.Rel(workTree, directory)
+	if err != nil || relativeDirectory == "." || strings.HasPrefix(relativeDirectory, "..") {
+		return matcher, nil
+	}
+	base := ""
+	for _, name := range strings.Split(filepath.ToSlash(relativeDirectory), "/") {
+		if err := matcher.load(filepath.Join(workTree, filepath.FromSlash(base), ".gitignore"), base); err != nil {
+			return nil, err
+		}
+		base = path.Join(base, name)
+	}
+
+	return matcher, nil
+}
+
+// Walks the files of a work tree below a directory, skipping the .git directories, the files ignored by git, and the
+// working trees of submodules and nested repositories (directories with a .git file or directory)
+// The given function is called with the path of each file, and its path relative to the work tree, slash separated.
+func walkGitWorkTree(workTree string, gitRepoPath string, directory string, walkFn func(path string, workTreePath string) error) error {
+	ignores, err := newGitignoreMatcher(workTree, gitRepoPath, directory)
+	if err != nil {
+		return fmt.Errorf("unable to read .gitignore files: %w", err)
+	}
+
+	return filepath.WalkDir(directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		workTreePath, _ := filepath.Rel(workTree, path)
+		workTreePath = filepath.ToSlash(workTreePath)
+
+		if entry.IsDir() {
+			if entry.Name() == gitRepoDirectory {
+				return filepath.SkipDir
+			}
+			if path != directory && ignores.ignored(workTreePath, true) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Lstat(filepath.Join(path, gitRepoDirectory)); err == nil && path != directory {
+				return filepath.SkipDir
+			}
+			base := workTreePath
+			if base == "." {
+				base = ""
+			}
+			return ignores.load(filepath.Join(path, ".gitignore"), base)
+		}
+
+		if ignores.ignored(workTreePath, false) {
+			return nil
+		}
+		return walkFn(path, workTreePath)
+	})
+}
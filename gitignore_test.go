@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+)
+
+var gitignoreData = []struct {
+	rules   []string
+	path    string
+	isDir   bool
+	ignored bool
+}{
+	{[]string{"*.log"}, "app.log", false, true},
+	{[]string{"*.log"}, "logs/app.log", false, true},
+	{[]string{"*.log", "!keep.log"}, "logs/keep.log", false, false},
+	{[]string{"build/"}, "build", true, true},
+	{[]string{"build/"}, "build", false, false},
+	{[]string{"build/"}, "src/build", true, true},
+	{[]string{"/build"}, "src/build", true, false},
+	{[]string{"doc/*.yml"}, "doc/ci.yml", false, true},
+	{[]string{"doc/*.yml"}, "src/doc/ci.yml", false, false},
+	{[]string{"**/tmp"}, "a/b/tmp", true, true},
+	{[]string{"# comment", ""}, "# comment", false, false},
+	{[]string{`\#file`}, "#file", false, true},
+}
+
+func TestGitignoreMatcher(t *testing.T) {
+	for _, testData := range gitignoreData {
+		t.Run("path="+testData.path, func(t *testing.T) {
+			matcher := &gitignoreMatcher{}
+			for _, line := range testData.rules {
+				if rule, ok := parseGitignoreLine(line, ""); ok {
+					matcher.rules = append(matcher.rules, rule)
+				}
+			}
+			if ignored := matcher.ignored(testData.path, testData.isDir); ignored != testData.ignored {
+				t.Errorf("received ignored %v while expecting %v with rules %v", ignored, testData.ignored, testData.rules)
+			}
+		})
+	}
+}
+
+func TestGitignoreMatcherBase(t *testing.T) {
+	rule, _ := parseGitignoreLine("/*.yml", "vendor")
+	matcher := &gitignoreMatcher{rules: []gitignoreRule{rule}}
+
+	if !matcher.ignored("vendor/ci.yml", false) {
+		t.Errorf("received not ignored while expecting 'vendor/ci.yml' to be ignored")
+	}
+	if matcher.ignored("ci.yml", false) || matcher.ignored("vendor/sub/ci.yml", false) {
+		t.Errorf("received ignored while expecting the rule to only apply to the 'vendor' directory")
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-ini/ini"
+)
+
+// Tells if the files are read from the git index (the staged version) instead of the working tree
+// Enabled by default when running as a git pre-commit hook.
+var stagedMode = false
+
+// Patterns of the paths (relative to the repository root) that trigger the check when staged, in hook mode
+var hookTriggerPatterns []string
+
+// Signature of a git index file
+const gitIndexSignature = "DIRC"
+
+// Flags of a git index entry
+const (
+	gitIndexEntryExtendedFlag    = 0x4000
+	gitIndexEntryStageMask       = 0x3000
+	gitIndexEntryIntentToAddFlag = 0x2000
+)
+
+// Mode of the git index entries that are sparse directories
+const gitIndexSparseDirectoryMode = 0o040000
+
+// Signature of the cache tree extension of a git index file
+const gitIndexTreeExtension = "TREE"
+
+// An entry of the git index: a file staged for the next commit
+type gitIndexEntry struct {
+	path string
+	mode uint32
+	hash string
+}
+
+// Content of a git index file
+type gitIndex struct {
+	// Entries at stage 0
+	entries []gitIndexEntry
+	// Hashes of the trees of the staged directories, by path ("" for the root), from the cache tree extension
+	// Directories with changes since the trees were last computed are missing.
+	trees map[string]string
+}
+
+// Returns the path of the git index file of a repository
+// The GIT_INDEX_FILE environment variable, set by git when running hooks for partial commits, has precedence.
+func gitIndexFilePath(gitRepoPath string) string {
+	if indexFile := os.Getenv("GIT_INDEX_FILE"); indexFile != "" {
+		indexFile, _ = filepath.Abs(indexFile)
+		return indexFile
+	}
+	return filepath.Join(gitRepoPath, "index")
+}
+
+// Returns the size in bytes of the object hashes of a repository: 32 for sha256 repositories, else 20 (sha1)
+func gitHashSize(gitRepoPath string) int {
+	cfg, err := loadGitCfg(gitRepoPath)
+	if err != nil {
+		return 20
+	}
+	objectFormat, _ := gitCfgValue([]*ini.File{cfg}, "extensions", "objectformat")
+	if strings.EqualFold(objectFormat, "sha256") {
+		return 32
+	}
+	return 20
+}
+
+// Reads a variable length integer of a version 4 git index entry, and returns it with the number of bytes read
+func readGitIndexVarint(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	i := 0
+	b := data[i]
+	value := int(b & 0x7f)
+	for b&0x80 != 0 {
+		i++
+		if i >= len(data) {
+			return 0, 0
+		}
+		b = data[i]
+		value = ((value + 1) << 7) | int(b&0x7f)
+	}
+
+	return value, i + 1
+}
+
+// Parses the content of a git index file (version 2, 3 or 4), and returns its entries at stage 0 and its cache tree
+// Entries only intended to be added, and sparse directories, are ignored.
+func parseGitIndex(data []byte, hashSize int) (*gitIndex, error) {
+	if len(data) < 12 || string(data[:4]) != gitIndexSignature {
+		return nil, errors.New("invalid git index signature")
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported git index version %d", version)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:12]))
+
+	entries := make([]gitIndexEntry, 0, count)
+	offset := 12
+	previousPath := ""
+	for range count {
+		start := offset
+		headerSize := 40 + hashSize + 2
+		if offset+headerSize > len(data) {
+			return nil, errors.New("truncated git index entry")
+		}
+		mode := binary.BigEndian.Uint32(data[offset+24 : offset+28])
+		hash := hex.EncodeToString(data[offset+40 : offset+40+hashSize])
+		flags := binary.BigEndian.Uint16(data[offset+40+hashSize : offset+headerSize])
+		offset += headerSize
+
+		var extendedFlags uint16
+		if version >= 3 && flags&gitIndexEntryExtendedFlag != 0 {
+			if offset+2 > len(data) {
+				return nil, errors.New("truncated git index entry")
+			}
+			extendedFlags = binary.BigEndian.Uint16(data[offset : offset+2])
+			offset += 2
+		}
+
+		var path string
+		if version == 4 {
+			// Path is prefix compressed: a number of bytes to remove from the previous path, then a suffix
+			strip, n := readGitIndexVarint(data[offset:])
+			if n == 0 || strip > len(previousPath) {
+				return nil, errors.New("invalid git index entry path")
+			}
+			offset += n
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, errors.New("truncated git index entry path")
+			}
+			path = previousPath[:len(previousPath)-strip] + string(data[offset:offset+end])
+			offset += end + 1
+		} else {
+			end := bytes.IndexByte(data[offset:], 0)
+			if end < 0 {
+				return nil, errors.New("truncated git index entry path")
+			}
+			path = string(data[offset : offset+end])
+			// Entries are padded with 1 to 8 NUL bytes, to a multiple of 8 bytes
+			offset = start + ((offset + end - start + 8) &^ 7)
+		}
+		previousPath = path
+
+		if flags&gitIndexEntryStageMask != 0 || extendedFlags&gitIndexEntryIntentToAddFlag != 0 ||
+			mode == gitIndexSparseDirectoryMode {
+			continue
+		}
+		entries = append(entries, gitIndexEntry{path: path, mode: mode, hash: hash})
+	}
+
+	// Extensions follow the entries, up to the trailing checksum: a signature, a size, and the data
+	index := &gitIndex{entries: entries, trees: map[string]string{}}
+	for offset+8 <= len(data)-hashSize {
+		size := int(binary.BigEndian.Uint32(data[offset+4 : offset+8]))
+		if offset+8+size > len(data)-hashSize {
+			return nil, errors.New("truncated git index extension")
+		}
+		if string(data[offset:offset+4]) == gitIndexTreeExtension {
+			if _, err := parseGitCacheTree(data[offset+8:offset+8+size], "", hashSize, index.trees); err != nil {
+				return nil, err
+			}
+		}
+		offset += 8 + size
+	}
+
+	return index, nil
+}
+
+// Parses an entry of the cache tree extension of a git index file, and its sub trees, adding the valid trees to the
+// given map. Returns the data following the entry.
+// An entry is made of "<name>\0<entry count> <sub tree count>\n", followed by the binary tree hash if the entry count is
+// not negative. A negative count means the tree was invalidated by a change of the index.
+func parseGitCacheTree(data []byte, prefix string, hashSize int, trees map[string]string) ([]byte, error) {
+	nameEnd := bytes.IndexByte(data, 0)
+	if nameEnd < 0 {
+		return nil, errors.New("invalid git index cache tree")
+	}
+	treePath := path.Join(prefix, string(data[:nameEnd]))
+	data = data[nameEnd+1:]
+	lineEnd := bytes.IndexByte(data, '\n')
+	if lineEnd < 0 {
+		return nil, errors.New("invalid git index cache tree")
+	}
+	entryCountString, subTreeCountString, found := strings.Cut(string(data[:lineEnd]), " ")
+	entryCount, err := strconv.Atoi(entryCountString)
+	if !found || err != nil {
+		return nil, errors.New("invalid git index cache tree")
+	}
+	subTreeCount, err := strconv.Atoi(subTreeCountString)
+	if err != nil {
+		return nil, errors.New("invalid git index cache tree")
+	}
+	data = data[lineEnd+1:]
+
+	if entryCount >= 0 {
+		if len(data) < hashSize {
+			return nil, errors.New("truncated git index cache tree")
+		}
+		trees[treePath] = hex.EncodeToString(data[:hashSize])
+		data = data[hashSize:]
+	}
+	for range subTreeCount {
+		if data, err = parseGitCacheTree(data, treePath, hashSize, trees); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// Reads the git index of a repository
+func readGitIndex(gitRepoPath string) (*gitIndex, error) {
+	data, err := os.ReadFile(gitIndexFilePath(gitRepoPath))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGitIndex(data, gitHashSize(gitRepoPath))
+}
+
+// Files staged in the git index of a repository, whose content is read from the git objects
+type indexFiles struct {
+	gitRepoPath string
+	entries     map[string]gitIndexEntry
+	paths       []string
+}
+
+// Loads the files staged in the git index of a repository
+func newIndexFiles(gitRepoPath string) (*indexFiles, error) {
+	index, err := readGitIndex(gitRepoPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read git index: %w", err)
+	}
+	entries := index.entries
+
+	files := &indexFiles{
+		gitRepoPath: gitRepoPath,
+		entries:     make(map[string]gitIndexEntry, len(entries)),
+		paths:       make([]string, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		files.entries[entry.path] = entry
+		files.paths = append(files.paths, entry.path)
+	}
+
+	return files, nil
+}
+
+func (files *indexFiles) readFile(relativePath string) ([]byte, error) {
+	entry, ok := files.entries[relativePath]
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not in the git index: %w", relativePath, os.ErrNotExist)
+	}
+
+	objectType, content, err := readGitObject(files.gitRepoPath, entry.hash)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read '%s' from the git index: %w", relativePath, err)
+	}
+	if objectType != gitObjectBlob {
+		return nil, fmt.Errorf("'%s' in the git index is not a file", relativePath)
+	}
+
+	return content, nil
+}
+
+func (files *indexFiles) listFiles() ([]string, error) {
+	return files.paths, nil
+}
+
+// A file whose changes are staged in the git index
+type stagedFile struct {
+	path    string
+	deleted bool
+}
+
+// Returns the files that differ between the git index and the HEAD commit, i.e. the changes to be committed
+// The directories whose tree in the index cache tree is the HEAD one are unchanged, and are not read.
+func readGitStagedFiles(gitRepoPath string) ([]stagedFile, error) {
+	index, err := readGitIndex(gitRepoPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read git index: %w", err)
+	}
+
+	head := map[string]gitIndexEntry{}
+	unchanged := map[string]bool{}
+	headHash, err := resolveGitRef(gitRepoPath, "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve git HEAD: %w", err)
+	}
+	// Without HEAD commit (first commit), all the files are staged
+	if headHash != "" {
+		treeHash, err := readGitCommitTree(gitRepoPath, headHash)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read git HEAD commit: %w", err)
+		}
+		if index.trees[""] == treeHash {
+			return []stagedFile{}, nil
+		}
+		headEntries, err := readGitTree(gitRepoPath, treeHash, "", index.trees)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read git HEAD tree: %w", err)
+		}
+		for _, entry := range headEntries {
+			if entry.mode == gitTreeModeDirectory {
+				unchanged[entry.path] = true
+			} else {
+				head[entry.path] = entry
+			}
+		}
+	}
+
+	staged := []stagedFile{}
+	for _, entry := range index.entries {
+		if isInGitDirectories(entry.path, unchanged) {
+			continue
+		}
+		headEntry, ok := head[entry.path]
+		if !ok || headEntry.hash != entry.hash || headEntry.mode != entry.mode {
+			staged = append(staged, stagedFile{path: entry.path})
+		}
+		delete(head, entry.path)
+	}
+	for path := range head {
+		staged = append(staged, stagedFile{path: path, deleted: true})
+	}
+
+	return staged, nil
+}
+
+// Tells if a path (slash separated) is in one of the given directories, or their sub directories
+func isInGitDirectories(filePath string, directories map[string]bool) bool {
+	if len(directories) == 0 {
+		return false
+	}
+	for directory := path.Dir(filePath); directory != "."; directory = path.Dir(directory) {
+		if directories[directory] {
+			return true
+		}
+	}
+	return false
+}
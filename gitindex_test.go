@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Runs a git command in a directory, failing the test on error
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "HOME="+dir)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s failed: %s\n%s", strings.Join(args, " "), err, output)
+	}
+}
+
+func TestIndexFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	// Not running as a hook: the index of the repository is used
+	t.Setenv("GIT_INDEX_FILE", "")
+	_ = os.Unsetenv("GIT_INDEX_FILE")
+
+	workTree := t.TempDir()
+	runGit(t, workTree, "init", "-q")
+	if err := os.MkdirAll(filepath.Join(workTree, "ci"), 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	// Several versions of a file are committed then packed, and the first one, stored as a delta, is staged back
+	var content strings.Builder
+	firstVersion := ""
+	for i := range 5 {
+		content.WriteString(strings.Repeat("job"+string(rune('a'+i))+":\n  script: echo\n", 50))
+		if err := os.WriteFile(filepath.Join(workTree, "ci", "jobs.yml"), []byte(content.String()), 0600); err != nil {
+			t.Fatal(err)
+		}
+		runGit(t, workTree, "add", ".")
+		runGit(t, workTree, "commit", "-q", "-m", "version")
+		if i == 0 {
+			firstVersion = content.String()
+		}
+	}
+	runGit(t, workTree, "gc", "-q", "--aggressive")
+	runGit(t, workTree, "reset", "-q", "HEAD~4", "--", "ci/jobs.yml")
+
+	// Staged but not committed, then modified in the working tree
+	files := map[string]string{
+		".gitlab-ci.yml": "include: /ci/jobs.yml\n",
+		"ci/jobs.yml":    firstVersion,
+	}
+	if err := os.WriteFile(filepath.Join(workTree, ".gitlab-ci.yml"), []byte(files[".gitlab-ci.yml"]), 0600); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, workTree, "add", ".gitlab-ci.yml")
+	if err := os.WriteFile(filepath.Join(workTree, ".gitlab-ci.yml"), []byte("modified"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []string{"2", "3", "4"} {
+		t.Run("index-version="+version, func(t *testing.T) {
+			runGit(t, workTree, "update-index", "--index-version", version)
+
+			index, err := newIndexFiles(filepath.Join(workTree, ".git"))
+			if err != nil {
+				t.Fatalf("received error '%s' while expecting none", err)
+			}
+			paths, _ := index.listFiles()
+			sort.Strings(paths)
+			if strings.Join(paths, ",") != ".gitlab-ci.yml,ci/jobs.yml" {
+				t.Errorf("received files %v while expecting [.gitlab-ci.yml ci/jobs.yml]", paths)
+			}
+			for path, expected := range files {
+				received, err := index.readFile(path)
+				if err != nil {
+					t.Errorf("received error '%s' while expecting none for '%s'", err, path)
+				} else if string(received) != expected {
+					t.Errorf("received content '%.40s...' while expecting '%.40s...' for '%s'", received, expected, path)
+				}
+			}
+			if _, err := index.readFile("missing.yml"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("received error '%v' while expecting a not exist error", err)
+			}
+		})
+	}
+
+	// Concurrent checks share the pack indexes, loaded once per repository
+	index, err := newIndexFiles(filepath.Join(workTree, ".git"))
+	if err != nil {
+		t.Fatalf("received error '%s' while expecting none", err)
+	}
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if received, err := index.readFile("ci/jobs.yml"); err != nil || string(received) != firstVersion {
+				t.Errorf("received content '%.40s...' and error '%v' while reading concurrently", received, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if packs, err := loadGitPackIndexes(filepath.Join(workTree, ".git", "objects")); err != nil || len(packs) != 1 {
+		t.Errorf("received %d pack indexes and error '%v' while expecting 1 and none", len(packs), err)
+	}
+}
+
+func TestApplyGitDelta(t *testing.T) {
+	base := []byte("hello world")
+	// Base size 11, result size 13, copy 6 bytes at offset 0, insert "gitlab!"
+	delta := []byte{11, 13, 0x80 | 0x10, 6, 7, 'g', 'i', 't', 'l', 'a', 'b', '!'}
+
+	result, err := applyGitDelta(base, delta)
+	if err != nil {
+		t.Fatalf("received error '%s' while expecting none", err)
+	}
+	if string(result) != "hello gitlab!" {
+		t.Errorf("received '%s' while expecting 'hello gitlab!'", result)
+	}
+
+	if _, err := applyGitDelta([]byte("hello"), delta); err == nil {
+		t.Errorf("received no error while expecting one for a wrong base size")
+	}
+}
+
+func TestReadGitStagedFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	t.Setenv("GIT_INDEX_FILE", "")
+	_ = os.Unsetenv("GIT_INDEX_FILE")
+
+	workTree := t.TempDir()
+	gitRepoPath := filepath.Join(workTree, ".git")
+	runGit(t, workTree, "init", "-q")
+	writeFile := func(path string, content string) {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(workTree, path)), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(workTree, path), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stagedPaths := func() string {
+		staged, err := readGitStagedFiles(gitRepoPath)
+		if err != nil {
+			t.Fatalf("received error '%s' while expecting none", err)
+		}
+		paths := []string{}
+		for _, file := range staged {
+			if file.deleted {
+				paths = append(paths, "-"+file.path)
+			} else {
+				paths = append(paths, file.path)
+			}
+		}
+		sort.Strings(paths)
+		return strings.Join(paths, ",")
+	}
+
+	// Before the first commit, all the files of the index are staged
+	writeFile(".gitlab-ci.yml", "include: /ci/jobs.yml\n")
+	writeFile("ci/jobs.yml", "job:\n  script: echo\n")
+	writeFile("main.go", "package main\n")
+	runGit(t, workTree, "add", ".")
+	if received := stagedPaths(); received != ".gitlab-ci.yml,ci/jobs.yml,main.go" {
+		t.Errorf("received staged files '%s' while expecting '.gitlab-ci.yml,ci/jobs.yml,main.go'", received)
+	}
+
+	// Packed refs are used to resolve HEAD
+	runGit(t, workTree, "commit", "-q", "-m", "initial")
+	runGit(t, workTree, "pack-refs", "--all")
+	if received := stagedPaths(); received != "" {
+		t.Errorf("received staged files '%s' while expecting none", received)
+	}
+
+	// The directories that are unchanged according to the index cache tree are not read: the HEAD tree of ci is removed
+	writeFile("main.go", "package main\n\n// Staged\n")
+	runGit(t, workTree, "add", "main.go")
+	output, err := exec.Command("git", "-C", workTree, "rev-parse", "HEAD:ci").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciTreeHash := strings.TrimSpace(string(output))
+	ciTreeObject := filepath.Join(gitRepoPath, "objects", ciTreeHash[:2], ciTreeHash[2:])
+	ciTree, err := os.ReadFile(ciTreeObject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(ciTreeObject); err != nil {
+		t.Fatal(err)
+	}
+	if received := stagedPaths(); received != "main.go" {
+		t.Errorf("received staged files '%s' while expecting 'main.go'", received)
+	}
+	if err := os.WriteFile(ciTreeObject, ciTree, 0600); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, workTree, "reset", "-q", "main.go")
+
+	// Unstaged changes are ignored
+	writeFile("main.go", "package main\n\nfunc main() {}\n")
+	writeFile("ci/jobs.yml", "job:\n  script: changed\n")
+	runGit(t, workTree, "add", "ci/jobs.yml")
+	runGit(t, workTree, "rm", "-q", "--cached", ".gitlab-ci.yml")
+	if received := stagedPaths(); received != "-.gitlab-ci.yml,ci/jobs.yml" {
+		t.Errorf("received staged files '%s' while expecting '-.gitlab-ci.yml,ci/jobs.yml'", received)
+	}
+}
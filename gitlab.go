@@ -29,16 +29,18 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/fatih/color"
 	"gitlab.com/orobardet/gitlab-ci-linter/config"
 )
 
-// Filename of a gitlab-ci file. Used to find the gitlab-ci file if no path are given at calls
-const gitlabCiFileName = ".gitlab-ci.yml"
+// Filename patterns of a gitlab-ci file. Used to find the gitlab-ci file if no path are given at calls.
+// Patterns are tried in order in each directory.
+var gitlabCiFilePatterns = []string{".gitlab-ci.yml", ".gitlab-ci.yaml"}
 
 // Default Gitlab instance URL to use
 const defaultGitlabRootURL = "https://gitlab.com"
@@ -47,29 +49,59 @@ const defaultGitlabRootURL = "https://gitlab.com"
 const gitlabAPIProjectsPath = "/api/v4/projects/"
 const gitlabAPICiLintPath = "/ci/lint"
 
+// Path of the Gitlab API version endpoint, to be used on the root url
+const gitlabAPIVersionPath = "/api/v4/version"
+
+// GitlabAPIProject struct represents the JSON body of a response from the Gitlab API /projects/:id, limited to the
+// used fields
+type GitlabAPIProject struct {
+	ID                int    `json:"id"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	DefaultBranch     string `json:"default_branch"`
+	CiConfigPath      string `json:"ci_config_path"`
+}
+
 // GitlabAPILintRequest struct represents the JSON body of a request sent to the Gitlab API /ci/lint
 type GitlabAPILintRequest struct {
-	Content string `json:"content"`
-	DryRun  bool   `json:"dry_run"`
-	Ref     string `json:"ref"`
+	Content     string `json:"content"`
+	DryRun      bool   `json:"dry_run"`
+	IncludeJobs bool   `json:"include_jobs,omitempty"`
+	Ref         string `json:"ref"`
 }
 
 // GitlabAPILintResponse struct represents the JSON body of a response from the Gitlab API /ci/lint
 type GitlabAPILintResponse struct {
-	MergedYaml string   `json:"merged_yaml,omitempty"`
-	Warnings   []string `json:"warnings,omitempty"`
-	Errors     []string `json:"errors,omitempty"`
-	Valid      bool     `json:"valid,omitempty"`
+	MergedYaml string             `json:"merged_yaml,omitempty"`
+	Warnings   []string           `json:"warnings,omitempty"`
+	Errors     []string           `json:"errors,omitempty"`
+	Valid      bool               `json:"valid,omitempty"`
+	Jobs       []GitlabAPILintJob `json:"jobs,omitempty"`
 }
 
-// Search in the given directory a git repository directory
-// It goes up in the filesystem hierarchy until a repository is found, or the root is reach
-func findGitlabCiFile(directory string) (string, error) {
-	candidate := path.Join(directory, gitlabCiFileName)
+// GitlabAPILintJob struct represents a job of the simulated pipeline returned by the Gitlab API /ci/lint on dry run
+type GitlabAPILintJob struct {
+	Name         string   `json:"name"`
+	Stage        string   `json:"stage"`
+	When         string   `json:"when"`
+	AllowFailure bool     `json:"allow_failure"`
+	TagList      []string `json:"tag_list,omitempty"`
+	Environment  string   `json:"environment,omitempty"`
+}
 
-	fileInfo, err := os.Stat(candidate)
-	if !os.IsNotExist(err) && !fileInfo.IsDir() {
-		return candidate, nil
+// Search in the given directory a gitlab-ci file, matching one of gitlabCiFilePatterns
+// It goes up in the filesystem hierarchy until a file is found, or the root is reach
+func findGitlabCiFile(directory string) (string, error) {
+	for _, pattern := range gitlabCiFilePatterns {
+		candidates, err := filepath.Glob(filepath.Join(directory, pattern))
+		if err != nil {
+			return "", fmt.Errorf("invalid gitlab-ci file pattern '%s': %w", pattern, err)
+		}
+		for _, candidate := range candidates {
+			fileInfo, err := os.Stat(candidate)
+			if err == nil && !fileInfo.IsDir() {
+				return candidate, nil
+			}
+		}
 	}
 
 	// If we are at the root of the filesystem, it means we did not find any gitlab-ci file
@@ -80,10 +112,29 @@ func findGitlabCiFile(directory string) (string, error) {
 	return findGitlabCiFile(filepath.Dir(directory))
 }
 
+// Creates an HTTP client and a request to a Gitlab API, authenticated with the token if any
 func initGitlabHTTPClientRequest(method string, gitlabURL string, content string) (*http.Client, *http.Request, error) {
+	httpClient, req, err := initGitlabAnonymousHTTPClientRequest(method, gitlabURL, content)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := addGitlabToken(req, gitlabURL); err != nil {
+		return nil, nil, err
+	}
+
+	return httpClient, req, nil
+}
+
+// Creates an HTTP client and a request to a Gitlab API, without any token
+func initGitlabAnonymousHTTPClientRequest(method string, gitlabURL string, content string) (*http.Client, *http.Request, error) {
 	var httpClient *http.Client
 	var req *http.Request
 
+	tlsConfig, err := gitlabTLSConfig(gitlabURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	httpClient = &http.Client{
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
@@ -95,40 +146,47 @@ func initGitlabHTTPClientRequest(method string, gitlabURL string, content string
 			MaxIdleConns:          100,
 			IdleConnTimeout:       90 * time.Second,
 			TLSHandshakeTimeout:   10 * time.Second,
+			TLSClientConfig:       tlsConfig,
 			ExpectContinueTimeout: 1 * time.Second,
 		},
 		Timeout: time.Second * time.Duration(httpRequestTimeout),
 	}
 
-	req, err := http.NewRequest(method, gitlabURL, strings.NewReader(content))
+	req, err = http.NewRequest(method, gitlabURL, strings.NewReader(content))
 	if err != nil {
 		return nil, nil, err
 	}
 	req.Header.Add("Accept", "*/*")
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("User-Agent", fmt.Sprintf("%s/%s", config.APPNAME, config.VERSION))
+
+	return httpClient, req, nil
+}
+
+// Adds the token to a request to a Gitlab API: the one given as parameter, or else the one of .netrc for its host
+func addGitlabToken(req *http.Request, gitlabURL string) error {
 	if personalAccessToken != "" {
 		req.Header.Add("PRIVATE-TOKEN", personalAccessToken)
 	} else if useNetrc {
 		// Check if we can find a token in .netrc
 		if verboseMode {
-			fmt.Println("Checking .netrc for token...")
+			fmt.Fprintln(messageOutput, "Checking .netrc for token...")
 		}
 		token, err := getGitlabTokenFromNetrc(gitlabURL)
 
 		if err != nil {
-			return nil, nil, err
+			return err
 		} else if token != "" {
 			if verboseMode {
-				fmt.Println("Token found in .netrc")
+				fmt.Fprintln(messageOutput, "Token found in .netrc")
 			}
 			req.Header.Add("PRIVATE-TOKEN", token)
 		} else {
-			fmt.Println("No token found in .netrc")
+			fmt.Fprintln(messageOutput, "No token found in .netrc")
 		}
 	}
 
-	return httpClient, req, nil
+	return nil
 }
 
 // Check if we can get a response with the rootUrl on the API CI Lint endpoint, and if a redirection occurs
@@ -140,7 +198,7 @@ func checkGitlabAPIUrl(rootURL string, lintURL string, apiCIEndpoint string) (st
 	newLintURL := lintURL
 
 	if verboseMode {
-		fmt.Printf("Checking '%s' (using '%s')...\n", rootURL, lintURL)
+		fmt.Fprintf(messageOutput, "Checking '%s' (using '%s')...\n", rootURL, lintURL)
 	}
 
 	httpClient, req, err := initGitlabHTTPClientRequest("GET", lintURL, "")
@@ -148,10 +206,9 @@ func checkGitlabAPIUrl(rootURL string, lintURL string, apiCIEndpoint string) (st
 		return newLintURL, fmt.Errorf("unable to create an HTTP client: %w", err)
 	}
 
-	resp, err := httpClient.Do(req)
+	resp, err := doGitlabRequest(httpClient, req)
 
 	if err != nil {
-		fmt.Printf("%+v\n", req.Header)
 		return newLintURL, fmt.Errorf("HTTP request error: %w", err)
 	}
 	defer resp.Body.Close()
@@ -170,57 +227,59 @@ func checkGitlabAPIUrl(rootURL string, lintURL string, apiCIEndpoint string) (st
 	}
 
 	if resp.StatusCode != 200 {
-		return newLintURL, fmt.Errorf("HTTP request failed with status %s", resp.Status)
+		return newLintURL, newGitlabAPIError(resp)
 	}
 
 	if verboseMode {
-		fmt.Printf("Url '%s' validated\n", newLintURL)
+		fmt.Fprintf(messageOutput, "Url '%s' validated\n", newLintURL)
 	}
 
 	return newLintURL, nil
 }
 
 // Send the content of a gitlab-ci file to a Gitlab instance lint API to check its validity
-// In case of invalid, lint error messages are returned in `msgs`
-func lintGitlabCIUsingAPI(lintURL string, ciFileContent string) (status bool, msgs []string, err error) {
-
-	msgs = []string{}
-	status = false
+// The decoded response of the API is returned, with its lint error and warning messages
+func lintGitlabCIUsingAPI(lintURL string, ciFileContent string, ref string) (result GitlabAPILintResponse, err error) {
 
 	// Prepare the JSON content of the POST request:
 	// {
 	//   "content": "<ESCAPED CONTENT OF THE GITLAB-CI FILE>"
 	// }
-	if dryRunRef == "" {
-		if dryRunRef == "" {
-			// Find git repository. First, start from gitlab-ci file location
-			gitRepoPath, err := findGitRepo(filepath.Dir(gitlabCiFilePath))
-			if err == nil {
-				// if not found, search from directoryRoot
-				gitRepoPath, _ = findGitRepo(directoryRoot)
-			}
-			dryRunRef, _ = GetCurrentBranch(gitRepoPath)
-		}
-	}
 	var reqParams = GitlabAPILintRequest{
-		Content: ciFileContent,
-		DryRun:  dryRun,
-		Ref:     dryRunRef,
+		Content:     ciFileContent,
+		DryRun:      dryRun,
+		IncludeJobs: dryRun,
+		Ref:         ref,
 	}
 	reqBody, _ := json.Marshal(reqParams)
 
+	return requestGitlabLintAPI("POST", lintURL, string(reqBody))
+}
+
+// Validates the CI configuration stored at a ref of a Gitlab project, using the lint API of the project
+func lintGitlabCIRemoteRefUsingAPI(lintURL string, ref string) (result GitlabAPILintResponse, err error) {
+	remoteRefLintURL, err := gitlabRemoteRefLintURL(lintURL, ref)
+	if err != nil {
+		return
+	}
+
+	return requestGitlabLintAPI("GET", remoteRefLintURL, "")
+}
+
+// Sends a request to a Gitlab lint API, and decodes its response
+func requestGitlabLintAPI(method string, lintURL string, content string) (result GitlabAPILintResponse, err error) {
 	// Prepare requesting the API
 	if verboseMode {
-		fmt.Printf("Querying %s...\n", lintURL)
+		fmt.Fprintf(messageOutput, "Querying %s...\n", lintURL)
 	}
-	httpClient, req, err := initGitlabHTTPClientRequest("POST", lintURL, string(reqBody))
+	httpClient, req, err := initGitlabHTTPClientRequest(method, lintURL, content)
 	if err != nil {
 		err = fmt.Errorf("unable to create an HTTP client: %w", err)
 		return
 	}
 
 	// Make the request to the API
-	resp, err := httpClient.Do(req)
+	resp, err := doGitlabRequest(httpClient, req)
 	if err != nil {
 		err = fmt.Errorf("HTTP request error: %w", err)
 		return
@@ -228,7 +287,7 @@ func lintGitlabCIUsingAPI(lintURL string, ciFileContent string) (status bool, ms
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		err = fmt.Errorf("HTTP request failed with status %s", resp.Status)
+		err = newGitlabAPIError(resp)
 		return
 	}
 
@@ -238,72 +297,389 @@ func lintGitlabCIUsingAPI(lintURL string, ciFileContent string) (status bool, ms
 		err = fmt.Errorf("unable to parse response: %w", err)
 		return
 	}
-	var result GitlabAPILintResponse
-	err = json.Unmarshal([]byte(body), &result)
+	err = json.Unmarshal(body, &result)
 	if err != nil {
 		err = fmt.Errorf("unable to parse JSON response: %w", err)
+	}
+
+	return
+}
+
+// Returns the Gitlab project to target: the project ID or path given as parameter if any, else the given path
+func resolveGitlabProject(path string) string {
+	if projectID != "" {
+		return projectID
+	}
+
+	if projectPath != "" {
+		return projectPath
+	}
+
+	return path
+}
+
+// Get a Gitlab project from the API /projects/:id, given the URL of this API for the project
+func getGitlabProject(projectURL string) (project GitlabAPIProject, err error) {
+	if verboseMode {
+		fmt.Fprintf(messageOutput, "Querying %s...\n", projectURL)
+	}
+	httpClient, req, err := initGitlabHTTPClientRequest("GET", projectURL, "")
+	if err != nil {
+		err = fmt.Errorf("unable to create an HTTP client: %w", err)
 		return
 	}
 
-	if includeMergedYaml && result.MergedYaml != "" {
-		fmt.Printf("Merged yaml: %s\n", result.MergedYaml)
+	resp, err := doGitlabRequest(httpClient, req)
+	if err != nil {
+		err = fmt.Errorf("HTTP request error: %w", err)
+		return
 	}
+	defer resp.Body.Close()
 
-	// Analyse the results
-	if result.Valid {
-		status = true
-		err = nil
+	if resp.StatusCode != 200 {
+		err = newGitlabAPIError(resp)
 		return
 	}
 
-	if !result.Valid {
-		msgs = result.Errors
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		err = fmt.Errorf("unable to parse response: %w", err)
+		return
+	}
+	err = json.Unmarshal(body, &project)
+	if err != nil {
+		err = fmt.Errorf("unable to parse JSON response: %w", err)
 	}
 
 	return
 }
 
-func computeGitlabProjectPath(path string) string {
-	if projectID != "" {
-		return projectID
+// Returns the URL of the API /projects/:id of a project, from its lint API URL
+// Returns an empty string if the lint URL is not a project lint API URL
+func gitlabProjectURLFromLintURL(lintURL string) string {
+	u, err := url.Parse(lintURL)
+	if err != nil || !strings.HasSuffix(u.EscapedPath(), gitlabAPICiLintPath) || !strings.Contains(u.EscapedPath(), gitlabAPIProjectsPath) {
+		return ""
 	}
 
-	if projectPath != "" {
-		return url.QueryEscape(projectPath)
-	}
+	return strings.TrimSuffix(lintURL, gitlabAPICiLintPath)
+}
 
-	return url.QueryEscape(path)
+func computeGitlabProjectPath(path string) string {
+	return url.QueryEscape(resolveGitlabProject(path))
 }
 
-func guessGitlabAPIFromGitRemoteURL(remoteURL string) (lintURL string, err error) {
+// Guess the Gitlab lint API URL of the project of a git remote, and check that it answers
+// The root URL guessed from the remote host is replaced by the one the host settings map it to, if any. Else, if the
+// API does not answer for an http remote, the relative root of the instance is searched in the remote path.
+func guessGitlabAPIFromGitRemoteURL(remoteURL string, hosts []hostConfig) (lintURL string, project string, err error) {
 	rootURL, prjPath := parseGitRemoteURL(remoteURL)
+	isHTTPRemote := strings.HasPrefix(remoteURL, "http")
+	mappedURL := mapGitlabRootURL(hosts, rootURL)
+	if mappedURL != "" {
+		if verboseMode {
+			fmt.Fprintf(messageOutput, "Gitlab root URL '%s' mapped to '%s'\n", rootURL, mappedURL)
+		}
+		// The path of an http remote on the Gitlab instance host contains its relative root
+		if isHTTPRemote {
+			prjPath = trimGitlabRelativeRoot(mappedURL, prjPath)
+		}
+		rootURL = mappedURL
+	}
 
+	lintURL, project, err = checkGitlabProjectLintAPI(rootURL, prjPath)
+	if err == nil || mappedURL != "" || !isHTTPRemote {
+		return
+	}
+
+	if relativeRootURL, relativePrjPath := findGitlabRelativeRoot(rootURL, prjPath); relativeRootURL != "" {
+		if verboseMode {
+			fmt.Fprintf(messageOutput, "Gitlab instance found under the relative root '%s'\n", relativeRootURL)
+		}
+		return checkGitlabProjectLintAPI(relativeRootURL, relativePrjPath)
+	}
+
+	return
+}
+
+// Returns the lint API URL of a project on a Gitlab instance, given its root URL (with its relative root if any)
+// The project is the one given as parameter if any, else the given path.
+func gitlabProjectLintURL(rootURL string, prjPath string) (lintURL string, project string, apiCIEndpoint string, err error) {
+	project = resolveGitlabProject(prjPath)
 	prjPath = computeGitlabProjectPath(prjPath)
 	if prjPath == "" {
-		return "", errors.New("unable to determine Gitlab project path, you can use --project-path|-P|$GCL_PROJECT_PATH or --project-id|-I|$GCL_PROJECT_ID, to give the path or ID of your Gitlab project")
+		return "", "", "", errors.New("unable to determine Gitlab project path, you can use --project-path|-P|$GCL_PROJECT_PATH or --project-id|-I|$GCL_PROJECT_ID, to give the path or ID of your Gitlab project")
 	}
 
-	apiCIEndpoint, err := url.JoinPath(gitlabAPIProjectsPath, prjPath, gitlabAPICiLintPath)
+	apiCIEndpoint, err = url.JoinPath(gitlabAPIProjectsPath, prjPath, gitlabAPICiLintPath)
 	if err != nil {
-		return "", err
+		return "", "", "", err
 	}
 
 	lintURL, err = url.JoinPath(rootURL, apiCIEndpoint)
 	if err != nil {
-		return "", err
+		return "", "", "", err
+	}
+
+	return lintURL, project, apiCIEndpoint, nil
+}
+
+// Returns the lint API URL of a project on a Gitlab instance, after checking that it answers
+func checkGitlabProjectLintAPI(rootURL string, prjPath string) (lintURL string, project string, err error) {
+	lintURL, project, apiCIEndpoint, err := gitlabProjectLintURL(rootURL, prjPath)
+	if err != nil {
+		return "", "", err
 	}
 
 	lintURL, err = checkGitlabAPIUrl(rootURL, lintURL, apiCIEndpoint)
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 	if lintURL != "" {
 		if verboseMode {
-			fmt.Printf("API url found: %s\n", lintURL)
+			fmt.Fprintf(messageOutput, "API url found: %s\n", lintURL)
 		}
 	} else {
-		return "", errors.New("unknown error occurs")
+		return "", "", errors.New("unknown error occurs")
 	}
 
 	return
 }
+
+// Removes the relative root of a Gitlab instance root URL from the path of a project on its web host, if present
+func trimGitlabRelativeRoot(rootURL string, prjPath string) string {
+	u, err := url.Parse(rootURL)
+	if err != nil {
+		return prjPath
+	}
+	if prefix := strings.Trim(u.Path, "/"); prefix != "" {
+		return strings.TrimPrefix(prjPath, prefix+"/")
+	}
+	return prjPath
+}
+
+// Searches the relative root of a Gitlab instance (e.g. "/gitlab" for "https://corp.example/gitlab/") in the path of an
+// http remote, by probing the API version endpoint under each path prefix, leaving at least a namespace and a project
+// Returns the root URL with the relative root, and the project path without it, or empty strings if not found.
+func findGitlabRelativeRoot(rootURL string, prjPath string) (string, string) {
+	segments := strings.Split(prjPath, "/")
+	for i := 1; i <= len(segments)-2; i++ {
+		candidateURL, err := url.JoinPath(rootURL, segments[:i]...)
+		if err != nil {
+			return "", ""
+		}
+		if isGitlabAPIRoot(candidateURL) {
+			return candidateURL, strings.Join(segments[i:], "/")
+		}
+	}
+
+	return "", ""
+}
+
+// Tells if a Gitlab API answers under a root URL: its version endpoint answers in JSON, possibly requiring an
+// authentication. The probe is sent without token, as the host may not be a Gitlab instance.
+func isGitlabAPIRoot(rootURL string) bool {
+	versionURL, err := url.JoinPath(rootURL, gitlabAPIVersionPath)
+	if err != nil {
+		return false
+	}
+	if verboseMode {
+		fmt.Fprintf(messageOutput, "Probing %s...\n", versionURL)
+	}
+
+	httpClient, req, err := initGitlabAnonymousHTTPClientRequest("GET", versionURL, "")
+	if err != nil {
+		return false
+	}
+	resp, err := doGitlabRequest(httpClient, req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	return (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusUnauthorized) &&
+		strings.Contains(resp.Header.Get("Content-Type"), "json")
+}
+
+// Git remote identifying the Gitlab project of a repository, with the lint API found from its URL
+type gitlabRemote struct {
+	name    string
+	url     string
+	lintURL string
+	project string
+	// Tells if previous candidate remotes were not answering as a Gitlab API
+	fallback bool
+}
+
+// Returns the names of the git remotes to try to find the Gitlab project of a repository, in order: the one given with
+// --remote, or else the upstream remote of the current branch, origin, then the other remotes
+func gitRemoteCandidates(gitRepoPath string) ([]string, error) {
+	if gitRemoteName != "" {
+		return []string{gitRemoteName}, nil
+	}
+
+	names, err := getGitRemoteNames(gitRepoPath)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []string{}
+	added := map[string]bool{}
+	for _, name := range append([]string{getGitBranchUpstreamRemote(gitRepoPath), "origin"}, names...) {
+		if name == "" || added[name] || !slices.Contains(names, name) {
+			continue
+		}
+		added[name] = true
+		candidates = append(candidates, name)
+	}
+
+	return candidates, nil
+}
+
+// Finds the git remote identifying the Gitlab project of a repository: the first candidate remote whose URL leads to a
+// responding Gitlab lint API. Returns nil if the repository has no remote.
+// The remotes are first probed without token. The token is only sent to the first candidate one, and to the fallback
+// ones on its Gitlab instance, on gitlab.com, or on a host of the user config file.
+func findGitlabRemote(gitRepoPath string) (*gitlabRemote, error) {
+	candidates, err := gitRemoteCandidates(gitRepoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cfgs, err := loadConfigFiles(gitRepoPath)
+	if err != nil {
+		return nil, err
+	}
+	hosts := configHosts(cfgs)
+
+	var firstErr error
+	trustedRootURLs := []string{defaultGitlabRootURL}
+	for i, name := range candidates {
+		remoteURL, err := getGitRemoteURL(gitRepoPath, name)
+		if err != nil {
+			return nil, err
+		}
+		if remoteURL == "" {
+			return nil, fmt.Errorf("git remote '%s' not found in repository", name)
+		}
+		remoteURLs := []string{remoteURL}
+		// A push url rewritten by pushInsteadOf, or a pushurl, can reach the Gitlab instance when the fetch one does not
+		if pushURL, err := getGitRemotePushURL(gitRepoPath, name); err == nil && pushURL != "" && pushURL != remoteURL {
+			remoteURLs = append(remoteURLs, pushURL)
+		}
+		if i == 0 {
+			trustedRootURLs = append(trustedRootURLs, gitlabRemoteRootURL(remoteURL, hosts))
+		}
+
+		for _, remoteURL := range remoteURLs {
+			if verboseMode {
+				fmt.Fprintf(messageOutput, "Trying git remote '%s' (%s)...\n", name, remoteURL)
+			}
+
+			rootURL := probeGitlabRemoteAPI(remoteURL, hosts)
+			if rootURL == "" {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("no responding Gitlab API found from repository's %s remote (%s)", name, remoteURL)
+				}
+				continue
+			}
+			if i > 0 && !isTrustedGitlabRootURL(rootURL, remoteURL, trustedRootURLs, hosts) {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("the Gitlab API found from repository's %s remote (%s) is on another host than the first remote: "+
+						"use --remote %s, or add its host to the user config file, to send it the token", name, remoteURL, name)
+				}
+				continue
+			}
+
+			lintURL, project, err := guessGitlabAPIFromGitRemoteURL(remoteURL, hosts)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("no valid and responding Gitlab API URL found from repository's %s remote: %w", name, err)
+				}
+				continue
+			}
+			return &gitlabRemote{name: name, url: remoteURL, lintURL: lintURL, project: project, fallback: i > 0}, nil
+		}
+	}
+
+	return nil, firstErr
+}
+
+// Returns the Gitlab root URL guessed from a git remote URL, as mapped by the host settings if any
+func gitlabRemoteRootURL(remoteURL string, hosts []hostConfig) string {
+	rootURL, _ := parseGitRemoteURL(remoteURL)
+	if mappedURL := mapGitlabRootURL(hosts, rootURL); mappedURL != "" {
+		return mappedURL
+	}
+	return rootURL
+}
+
+// Probes, without token, the Gitlab API guessed from a git remote URL, searching its relative root for an http remote
+// Returns the root URL of the API, or an empty string if it does not answer as a Gitlab API.
+func probeGitlabRemoteAPI(remoteURL string, hosts []hostConfig) string {
+	rootURL, prjPath := parseGitRemoteURL(remoteURL)
+	if mappedURL := mapGitlabRootURL(hosts, rootURL); mappedURL != "" {
+		if isGitlabAPIRoot(mappedURL) {
+			return mappedURL
+		}
+		return ""
+	}
+	if isGitlabAPIRoot(rootURL) {
+		return rootURL
+	}
+	if strings.HasPrefix(remoteURL, "http") {
+		relativeRootURL, _ := findGitlabRelativeRoot(rootURL, prjPath)
+		return relativeRootURL
+	}
+
+	return ""
+}
+
+// Tells if the token can be sent to the Gitlab API root URL found from a git remote URL: it is on the host of one of
+// the trusted root URLs, or the host of the remote has trusted host settings
+func isTrustedGitlabRootURL(rootURL string, remoteURL string, trustedRootURLs []string, hosts []hostConfig) bool {
+	u, err := url.Parse(rootURL)
+	if err != nil {
+		return false
+	}
+	for _, trustedRootURL := range trustedRootURLs {
+		if isSameGitlabHost(u, trustedRootURL) {
+			return true
+		}
+	}
+
+	remoteRootURL, _ := parseGitRemoteURL(remoteURL)
+	return isConfiguredGitlabHost(hosts, remoteRootURL)
+}
+
+// Returns the path of the Gitlab project of the first candidate git remote of a repository, on a Gitlab instance whose
+// root URL is given. Returns an empty string if there is no repository or remote.
+func gitRemoteProjectPath(gitRepoPath string, rootURL string) string {
+	if gitRepoPath == "" {
+		return ""
+	}
+	candidates, err := gitRemoteCandidates(gitRepoPath)
+	if err != nil || len(candidates) == 0 {
+		return ""
+	}
+	remoteURL, err := getGitRemoteURL(gitRepoPath, candidates[0])
+	if err != nil || remoteURL == "" {
+		return ""
+	}
+
+	_, prjPath := parseGitRemoteURL(remoteURL)
+	if strings.HasPrefix(remoteURL, "http") {
+		prjPath = trimGitlabRelativeRoot(rootURL, prjPath)
+	}
+	return prjPath
+}
+
+// Tells which git remote was chosen to identify the Gitlab project: in verbose mode, or when the first candidate
+// remotes did not answer as a Gitlab API
+func reportGitlabRemote(remote *gitlabRemote) {
+	if remote.fallback {
+		yellow := color.New(color.FgYellow).SprintFunc()
+		fmt.Fprintf(messageOutput, yellow("Using git remote '%s' (%s), as the previous ones do not answer as a Gitlab API\n"), remote.name, remote.url)
+	} else if verboseMode {
+		fmt.Fprintf(messageOutput, "Using git remote '%s' (%s)\n", remote.name, remote.url)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var gitlabProjectURLFromLintURLData = [][]string{
+	{"https://gitlab.com/api/v4/projects/my%2Fproject/ci/lint", "https://gitlab.com/api/v4/projects/my%2Fproject"},
+	{"https://gitlab.com/api/v4/projects/42/ci/lint", "https://gitlab.com/api/v4/projects/42"},
+	{"https://gitlab.com", ""},
+	{"https://gitlab.com/ci/lint", ""},
+	{"", ""},
+}
+
+func TestGitlabProjectURLFromLintURL(t *testing.T) {
+	for _, testData := range gitlabProjectURLFromLintURLData {
+		lintURL := testData[0]
+		expected := testData[1]
+		t.Run("url="+lintURL, func(t *testing.T) {
+			if received := gitlabProjectURLFromLintURL(lintURL); received != expected {
+				t.Errorf("received project URL '%s' while expecting '%s'", received, expected)
+			}
+		})
+	}
+}
+
+func TestFindGitlabCiFile(t *testing.T) {
+	root := t.TempDir()
+	subDirectory := filepath.Join(root, "src", "app")
+	if err := os.MkdirAll(subDirectory, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".gitlab-ci.yaml"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := findGitlabCiFile(subDirectory)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if expected := filepath.Join(root, ".gitlab-ci.yaml"); file != expected {
+		t.Errorf("received '%s' while expecting '%s'", file, expected)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, ".gitlab-ci.yml"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, _ = findGitlabCiFile(subDirectory)
+	if expected := filepath.Join(root, ".gitlab-ci.yml"); file != expected {
+		t.Errorf("received '%s' while expecting '%s', as patterns are tried in order", file, expected)
+	}
+}
+
+func TestGitRemoteCandidates(t *testing.T) {
+	root := t.TempDir()
+	gitDir := filepath.Join(root, ".git")
+	config := "[remote \"github\"]\n\turl = https://github.com/me/project.git\n" +
+		"[remote \"origin\"]\n\turl = git@gitlab.com:me/project.git\n" +
+		"[remote \"upstream\"]\n\turl = git@gitlab.com:team/project.git\n" +
+		"[branch \"feature\"]\n\tremote = upstream\n" +
+		"[branch \"local\"]\n\tremote = .\n"
+	createTestFiles(t, root, map[string]string{".git/config": config})
+
+	data := []struct {
+		head     string
+		remote   string
+		expected string
+	}{
+		{"ref: refs/heads/feature", "", "upstream,origin,github"},
+		{"ref: refs/heads/local", "", "origin,github,upstream"},
+		{"ref: refs/heads/main", "", "origin,github,upstream"},
+		{"ref: refs/heads/feature", "github", "github"},
+	}
+	defer func(name string) { gitRemoteName = name }(gitRemoteName)
+	for _, testData := range data {
+		t.Run("head="+testData.head+",remote="+testData.remote, func(t *testing.T) {
+			createTestFiles(t, root, map[string]string{".git/HEAD": testData.head + "\n"})
+			gitRemoteName = testData.remote
+
+			candidates, err := gitRemoteCandidates(gitDir)
+			if err != nil {
+				t.Fatalf("received error '%s' while expecting none", err)
+			}
+			if received := strings.Join(candidates, ","); received != testData.expected {
+				t.Errorf("received remotes '%s' while expecting '%s'", received, testData.expected)
+			}
+		})
+	}
+}
+
+func TestGitlabRelativeRoot(t *testing.T) {
+	// Gitlab instance under the /gitlab relative root, serving the team/app project
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.EscapedPath() {
+		case "/gitlab/api/v4/version":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/gitlab/api/v4/projects/team%2Fapp/ci/lint":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	rootURL, prjPath := findGitlabRelativeRoot(server.URL, "gitlab/team/app")
+	if rootURL != server.URL+"/gitlab" || prjPath != "team/app" {
+		t.Errorf("received '%s', '%s' while expecting the /gitlab relative root and the team/app project", rootURL, prjPath)
+	}
+	if rootURL, _ := findGitlabRelativeRoot(server.URL, "team/app"); rootURL != "" {
+		t.Errorf("received relative root '%s' while expecting none for a project path without prefix", rootURL)
+	}
+
+	expectedLintURL := server.URL + "/gitlab/api/v4/projects/team%2Fapp/ci/lint"
+	lintURL, project, err := guessGitlabAPIFromGitRemoteURL(server.URL+"/gitlab/team/app.git", nil)
+	if err != nil || lintURL != expectedLintURL || project != "team/app" {
+		t.Errorf("received '%s', '%s', '%v' while expecting '%s', 'team/app' and no error", lintURL, project, err, expectedLintURL)
+	}
+
+	// With a given Gitlab URL, the lint API is built from it, with the project of the remote
+	root := t.TempDir()
+	createTestFiles(t, root, map[string]string{
+		".git/config": "[remote \"origin\"]\n\turl = " + server.URL + "/gitlab/team/app.git\n",
+		".git/HEAD":   "ref: refs/heads/main\n",
+	})
+	defer func(url string) { gitlabRootURL = url }(gitlabRootURL)
+	gitlabRootURL = server.URL + "/gitlab"
+	lintURL, project, err = getGitlabLintURL(filepath.Join(root, ".git"))
+	if err != nil || lintURL != expectedLintURL || project != "team/app" {
+		t.Errorf("received '%s', '%s', '%v' while expecting '%s', 'team/app' and no error", lintURL, project, err, expectedLintURL)
+	}
+}
+
+func TestGitlabRemoteTokenIsOnlySentToTrustedRemotes(t *testing.T) {
+	tokens := map[string][]string{}
+	var mutex sync.Mutex
+	newServer := func(name string, gitlab bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			tokens[name] = append(tokens[name], r.Header.Get("PRIVATE-TOKEN"))
+			mutex.Unlock()
+			if !gitlab {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.EscapedPath() {
+			case "/api/v4/version":
+				w.WriteHeader(http.StatusUnauthorized)
+			case "/api/v4/projects/team%2Fapp/ci/lint":
+				w.WriteHeader(http.StatusOK)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+			_, _ = w.Write([]byte("{}"))
+		}))
+	}
+	// The first candidate remote is a mirror that is not a Gitlab instance, the fallback one is on another host
+	mirror := newServer("mirror", false)
+	defer mirror.Close()
+	gitlab := newServer("gitlab", true)
+	defer gitlab.Close()
+
+	root := t.TempDir()
+	setTestHomeDir(t, filepath.Join(root, "home"))
+	t.Setenv(gitDirEnv, "")
+	t.Setenv(gitWorkTreeEnv, "")
+	createTestFiles(t, root, map[string]string{
+		"repo/.git/config": "[remote \"origin\"]\n\turl = " + mirror.URL + "/team/app.git\n" +
+			"[remote \"upstream\"]\n\turl = " + gitlab.URL + "/team/app.git\n",
+		"repo/.git/HEAD":   "ref: refs/heads/main\n",
+		"config.yml":       "",
+		"config-hosts.yml": "hosts:\n  - host: " + strings.TrimPrefix(gitlab.URL, "http://") + "\n",
+	})
+	defer func(token string, attempts int64, output io.Writer, path string, remote string) {
+		personalAccessToken, retryMaxAttempts, messageOutput, userConfigPath, gitRemoteName = token, attempts, output, path, remote
+	}(personalAccessToken, retryMaxAttempts, messageOutput, userConfigPath, gitRemoteName)
+	personalAccessToken, retryMaxAttempts, messageOutput, gitRemoteName = "secret", 1, io.Discard, ""
+
+	data := []struct {
+		config   string
+		selected bool
+	}{
+		{"config.yml", false},
+		{"config-hosts.yml", true},
+	}
+	for _, testData := range data {
+		t.Run("config="+testData.config, func(t *testing.T) {
+			mutex.Lock()
+			clear(tokens)
+			mutex.Unlock()
+			userConfigPath = filepath.Join(root, testData.config)
+
+			remote, err := findGitlabRemote(filepath.Join(root, "repo", ".git"))
+			if testData.selected && (err != nil || remote == nil || remote.name != "upstream") {
+				t.Fatalf("received remote %v and error '%v' while expecting the upstream remote", remote, err)
+			}
+			if !testData.selected && err == nil {
+				t.Fatalf("received remote %v while expecting an error", remote)
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			for name, received := range tokens {
+				for i, token := range received {
+					if token != "" && (name != "gitlab" || !testData.selected || i == 0) {
+						t.Errorf("request %d to the %s remote received token '%s' while expecting none", i, name, token)
+					}
+				}
+			}
+			if testData.selected && !slices.Contains(tokens["gitlab"], "secret") {
+				t.Errorf("received tokens %v on the selected remote while expecting 'secret'", tokens["gitlab"])
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Maximum size of the body of a failure response of the Gitlab API that is read
+const maxGitlabErrorBodySize = 64 * 1024
+
+// GitlabAPIError struct represents a failure response of the Gitlab API, with the message of its JSON body if any
+type GitlabAPIError struct {
+	StatusCode int
+	Status     string
+	Message    string
+	// Tells if the request was authenticated with a token
+	withToken bool
+}
+
+// gitlabAPIErrorBody struct represents the JSON body of a failure response of the Gitlab API
+// The message can be a string, a list, or an object of messages by field.
+type gitlabAPIErrorBody struct {
+	Message          json.RawMessage `json:"message"`
+	Error            string          `json:"error"`
+	ErrorDescription string          `json:"error_description"`
+}
+
+// Creates the error of a failure response of the Gitlab API, decoding its body
+func newGitlabAPIError(resp *http.Response) *GitlabAPIError {
+	apiErr := &GitlabAPIError{StatusCode: resp.StatusCode, Status: resp.Status}
+	if resp.Request != nil {
+		apiErr.withToken = resp.Request.Header.Get("PRIVATE-TOKEN") != ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxGitlabErrorBodySize))
+	if err != nil {
+		return apiErr
+	}
+	var errorBody gitlabAPIErrorBody
+	if json.Unmarshal(body, &errorBody) != nil {
+		return apiErr
+	}
+
+	messages := []string{}
+	if message := flattenGitlabAPIMessage(errorBody.Message, ""); message != "" {
+		messages = append(messages, message)
+	}
+	if errorBody.Error != "" {
+		messages = append(messages, errorBody.Error)
+	}
+	if errorBody.ErrorDescription != "" {
+		messages = append(messages, errorBody.ErrorDescription)
+	}
+	apiErr.Message = strings.Join(messages, ": ")
+
+	return apiErr
+}
+
+// Returns a message of the Gitlab API as a single string: a list is joined, and the messages of an object are prefixed
+// with their field
+func flattenGitlabAPIMessage(raw json.RawMessage, prefix string) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return strings.TrimSpace(prefix + " " + text)
+	}
+
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		messages := []string{}
+		for _, item := range list {
+			if message := flattenGitlabAPIMessage(item, prefix); message != "" {
+				messages = append(messages, message)
+			}
+		}
+		return strings.Join(messages, ", ")
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) == nil {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		messages := []string{}
+		for _, name := range names {
+			if message := flattenGitlabAPIMessage(fields[name], strings.TrimSpace(prefix+" "+name)); message != "" {
+				messages = append(messages, message)
+			}
+		}
+		return strings.Join(messages, ", ")
+	}
+
+	return ""
+}
+
+// Returns the error message, with the message of the Gitlab API if any
+func (e *GitlabAPIError) Error() string {
+	if e.Message == "" || e.Message == e.Status {
+		return fmt.Sprintf("HTTP request failed with status %s", e.Status)
+	}
+	return fmt.Sprintf("HTTP request failed with status %s: %s", e.Status, e.Message)
+}
+
+// Returns a hint about the probable cause of the failure, and how to fix it, or an empty string
+func (e *GitlabAPIError) Hint() string {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		if !e.withToken {
+			return "No personal access token was given: set one with --personal-access-token|-p|$GCL_PERSONAL_ACCESS_TOKEN, or in .netrc with --netrc|-n"
+		}
+		return "The personal access token is invalid, expired or revoked: create a new one with the 'api' scope"
+	case http.StatusForbidden:
+		if strings.Contains(e.Message, "insufficient_scope") {
+			return "The personal access token has an insufficient scope: the 'api' scope is needed"
+		}
+		return "The access is forbidden: the personal access token needs the 'api' scope, and your access level to the project must allow running pipelines (at least Developer)"
+	case http.StatusNotFound:
+		if !e.withToken {
+			return "The project was not found: its path may be wrong (use --project-path|-P or --project-id|-I), or it is private and a personal access token is needed"
+		}
+		return "The project was not found: its path may be wrong (use --project-path|-P or --project-id|-I), or the personal access token does not give access to it"
+	case http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return "The gitlab-ci content may be too large, or too deeply nested, for the limits of the Gitlab instance"
+	}
+	return ""
+}
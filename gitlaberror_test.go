@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGitlabAPIError(t *testing.T) {
+	data := []struct {
+		status          int
+		body            string
+		withToken       bool
+		expectedMessage string
+		expectedHint    string
+	}{
+		{401, `{"message":"401 Unauthorized"}`, false, "HTTP request failed with status 401 Unauthorized", "No personal access token"},
+		{401, `{"message":"401 Unauthorized"}`, true, "HTTP request failed with status 401 Unauthorized", "invalid, expired or revoked"},
+		{403, `{"error":"insufficient_scope","error_description":"The request requires higher privileges than provided by the access token."}`, true,
+			"HTTP request failed with status 403 Forbidden: insufficient_scope: The request requires higher privileges than provided by the access token.", "insufficient scope"},
+		{403, `{"message":"403 Forbidden"}`, true, "HTTP request failed with status 403 Forbidden", "at least Developer"},
+		{404, `{"message":"404 Project Not Found"}`, false, "HTTP request failed with status 404 Not Found: 404 Project Not Found", "private and a personal access token is needed"},
+		{422, `{"message":{"content":["is too long","is invalid"],"base":"oops"}}`, true,
+			"HTTP request failed with status 422 Unprocessable Entity: base oops, content is too long, content is invalid", "too large"},
+		{502, `<html>Bad Gateway</html>`, true, "HTTP request failed with status 502 Bad Gateway", ""},
+	}
+	for _, testData := range data {
+		req, _ := http.NewRequest("GET", "https://gitlab.com/api/v4/projects/1/ci/lint", nil)
+		if testData.withToken {
+			req.Header.Set("PRIVATE-TOKEN", "secret")
+		}
+		resp := &http.Response{
+			StatusCode: testData.status,
+			Status:     fmt.Sprintf("%d %s", testData.status, http.StatusText(testData.status)),
+			Body:       io.NopCloser(strings.NewReader(testData.body)),
+			Request:    req,
+		}
+
+		result := newCheckResult(".gitlab-ci.yml")
+		result.setError(fmt.Errorf("error linting using Gitlab API: %w", newGitlabAPIError(resp)))
+		var apiErr *GitlabAPIError
+		if !errors.As(result.err, &apiErr) || apiErr.Error() != testData.expectedMessage {
+			t.Errorf("received error '%v' while expecting '%s'", apiErr, testData.expectedMessage)
+		}
+		if (testData.expectedHint == "") != (result.Hint == "") || !strings.Contains(result.Hint, testData.expectedHint) {
+			t.Errorf("received hint '%s' for status %d while expecting '%s'", result.Hint, testData.status, testData.expectedHint)
+		}
+		if strings.Contains(result.Error+result.Hint, "secret") {
+			t.Errorf("received the token in the error '%s'", result.Error)
+		}
+	}
+}
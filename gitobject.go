@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Types of git objects, as numbered in pack files
+const (
+	gitObjectCommit   = 1
+	gitObjectTree     = 2
+	gitObjectBlob     = 3
+	gitObjectTag      = 4
+	gitObjectOfsDelta = 6
+	gitObjectRefDelta = 7
+)
+
+// Mode of the git tree entries that are directories
+const gitTreeModeDirectory = 0o040000
+
+// Maximum length of a chain of deltas in a pack file, to protect against corrupted packs
+const maxGitDeltaDepth = 1000
+
+// Signature of version 2 pack index files
+var gitPackIndexSignature = []byte{0xff, 't', 'O', 'c'}
+
+// Error returned when a git object can not be found in a repository
+var errGitObjectNotFound = errors.New("git object not found")
+
+// Returns the type number of a git object, given its name in loose object headers
+func gitObjectTypeFromName(name string) int {
+	switch name {
+	case "commit":
+		return gitObjectCommit
+	case "tree":
+		return gitObjectTree
+	case "blob":
+		return gitObjectBlob
+	case "tag":
+		return gitObjectTag
+	}
+	return 0
+}
+
+// Reads a git object of a repository, from loose objects, pack files, or alternate object directories, and returns its
+// type and content
+func readGitObject(gitRepoPath string, hash string) (int, []byte, error) {
+	return readGitObjectAtDepth(filepath.Join(gitCommonDir(gitRepoPath), "objects"), hash, 0)
+}
+
+func readGitObjectAtDepth(objectsDir string, hash string, depth int) (int, []byte, error) {
+	if len(hash) < 3 {
+		return 0, nil, fmt.Errorf("invalid git object hash '%s'", hash)
+	}
+
+	objectType, content, err := readGitLooseObject(objectsDir, hash)
+	if !errors.Is(err, os.ErrNotExist) {
+		return objectType, content, err
+	}
+
+	packs, err := loadGitPackIndexes(objectsDir)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, packIndex := range packs {
+		objectType, content, err := readGitPackedObject(objectsDir, packIndex, hash, depth)
+		if !errors.Is(err, errGitObjectNotFound) {
+			return objectType, content, err
+		}
+	}
+
+	// Objects borrowed from other repositories, one objects directory per line
+	if alternates, err := os.ReadFile(filepath.Join(objectsDir, "info", "alternates")); err == nil && depth < maxGitDeltaDepth { // #nosec G304
+		for _, alternate := range strings.Split(string(alternates), "\n") {
+			alternate = strings.TrimSpace(alternate)
+			if alternate == "" || strings.HasPrefix(alternate, "#") {
+				continue
+			}
+			objectType, content, err := readGitObjectAtDepth(resolveGitPath(objectsDir, alternate), hash, depth+1)
+			if !errors.Is(err, errGitObjectNotFound) {
+				return objectType, content, err
+			}
+		}
+	}
+
+	return 0, nil, fmt.Errorf("%w: %s", errGitObjectNotFound, hash)
+}
+
+// Reads a loose git object: a zlib compressed file, made of a header "<type> <size>\0" and the content
+func readGitLooseObject(objectsDir string, hash string) (int, []byte, error) {
+	file, err := os.Open(filepath.Join(objectsDir, hash[:2], hash[2:])) // #nosec G304
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	reader, err := zlib.NewReader(file)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid git object %s: %w", hash, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid git object %s: %w", hash, err)
+	}
+
+	headerEnd := bytes.IndexByte(data, 0)
+	if headerEnd < 0 {
+		return 0, nil, fmt.Errorf("invalid git object %s: missing header", hash)
+	}
+	header := bytes.SplitN(data[:headerEnd], []byte(" "), 2)
+	if len(header) != 2 {
+		return 0, nil, fmt.Errorf("invalid git object %s: invalid header", hash)
+	}
+	size, err := strconv.Atoi(string(header[1]))
+	content := data[headerEnd+1:]
+	if err != nil || size != len(content) {
+		return 0, nil, fmt.Errorf("invalid git object %s: invalid size", hash)
+	}
+
+	return gitObjectTypeFromName(string(header[0])), content, nil
+}
+
+// A version 2 pack index file, loaded in memory
+type gitPackIndex struct {
+	path  string
+	data  []byte
+	count int
+}
+
+// Pack index files of an objects directory, loaded once
+type gitPackIndexes struct {
+	once    sync.Once
+	indexes []*gitPackIndex
+	err     error
+}
+
+// Pack index files loaded by objects directory, shared by the concurrent checks
+var gitPackIndexesCache sync.Map
+
+// Returns the pack index files of an objects directory, read on first use
+func loadGitPackIndexes(objectsDir string) ([]*gitPackIndex, error) {
+	value, _ := gitPackIndexesCache.LoadOrStore(objectsDir, &gitPackIndexes{})
+	packs := value.(*gitPackIndexes)
+	packs.once.Do(func() {
+		paths, err := filepath.Glob(filepath.Join(objectsDir, "pack", "*.idx"))
+		if err != nil {
+			packs.err = err
+			return
+		}
+		for _, path := range paths {
+			index, err := readGitPackIndex(path)
+			if err != nil {
+				packs.err = err
+				return
+			}
+			packs.indexes = append(packs.indexes, index)
+		}
+	})
+
+	return packs.indexes, packs.err
+}
+
+// Reads a version 2 pack index file
+func readGitPackIndex(packIndex string) (*gitPackIndex, error) {
+	data, err := os.ReadFile(packIndex) // #nosec G304
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], gitPackIndexSignature) || binary.BigEndian.Uint32(data[4:8]) != 2 {
+		return nil, fmt.Errorf("unsupported git pack index '%s'", packIndex)
+	}
+
+	return &gitPackIndex{path: packIndex, data: data, count: int(binary.BigEndian.Uint32(data[8+255*4:]))}, nil
+}
+
+// Looks for an object in a pack index, and returns its offset in the pack file
+func findGitPackObjectOffset(packIndex *gitPackIndex, hash []byte) (int64, error) {
+	data, count := packIndex.data, packIndex.count
+	fanout := data[8 : 8+256*4]
+	first := 0
+	if hash[0] > 0 {
+		first = int(binary.BigEndian.Uint32(fanout[(int(hash[0])-1)*4:]))
+	}
+	last := int(binary.BigEndian.Uint32(fanout[int(hash[0])*4:]))
+
+	hashSize := len(hash)
+	namesStart := 8 + 256*4
+	offsetsStart := namesStart + count*hashSize + count*4
+	largeOffsetsStart := offsetsStart + count*4
+	if len(data) < largeOffsetsStart {
+		return 0, fmt.Errorf("truncated git pack index '%s'", packIndex.path)
+	}
+
+	// Binary search of the object name, in the names sharing its first byte
+	for first < last {
+		middle := (first + last) / 2
+		name := data[namesStart+middle*hashSize : namesStart+(middle+1)*hashSize]
+		switch cmp := bytes.Compare(name, hash); {
+		case cmp < 0:
+			first = middle + 1
+		case cmp > 0:
+			last = middle
+		default:
+			offset := binary.BigEndian.Uint32(data[offsetsStart+middle*4:])
+			if offset&0x80000000 == 0 {
+				return int64(offset), nil
+			}
+			// Offsets above 2GB are stored in a separate table of 64 bits offsets
+			largeOffset := largeOffsetsStart + int(offset&0x7fffffff)*8
+			if len(data) < largeOffset+8 {
+				return 0, fmt.Errorf("truncated git pack index '%s'", packIndex.path)
+			}
+			return int64(binary.BigEndian.Uint64(data[largeOffset:])), nil // #nosec G115
+		}
+	}
+
+	return 0, errGitObjectNotFound
+}
+
+// Reads a packed git object, given the pack index file where to look for it
+func readGitPackedObject(objectsDir string, packIndex *gitPackIndex, hash string, depth int) (int, []byte, error) {
+	rawHash, err := hex.DecodeString(hash)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid git object hash '%s'", hash)
+	}
+	offset, err := findGitPackObjectOffset(packIndex, rawHash)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	packFile := packIndex.path[:len(packIndex.path)-len(".idx")] + ".pack"
+	file, err := os.Open(packFile) // #nosec G304
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	return readGitPackObjectAt(objectsDir, file, offset, len(rawHash), depth)
+}
+
+// Reads the object at the given offset of an opened pack file, resolving deltas
+func readGitPackObjectAt(objectsDir string, pack *os.File, offset int64, hashSize int, depth int) (int, []byte, error) {
+	if depth > maxGitDeltaDepth {
+		return 0, nil, errors.New("too long chain of git deltas")
+	}
+
+	header := make([]byte, 32+hashSize)
+	n, err := pack.ReadAt(header, offset)
+	if n == 0 && err != nil {
+		return 0, nil, err
+	}
+	header = header[:n]
+
+	// Type and size of the object: 3 bits of type and 4 bits of size, then 7 bits of size per byte
+	pos := 0
+	next := func() (byte, error) {
+		if pos >= len(header) {
+			return 0, errors.New("truncated git pack object header")
+		}
+		b := header[pos]
+		pos++
+		return b, nil
+	}
+	b, err := next()
+	if err != nil {
+		return 0, nil, err
+	}
+	objectType := int(b>>4) & 0x7
+	for b&0x80 != 0 {
+		if b, err = next(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var baseType int
+	var base []byte
+	switch objectType {
+	case gitObjectOfsDelta:
+		// Base object is at a negative offset, in a variable length encoding
+		if b, err = next(); err != nil {
+			return 0, nil, err
+		}
+		baseOffset := int64(b & 0x7f)
+		for b&0x80 != 0 {
+			if b, err = next(); err != nil {
+				return 0, nil, err
+			}
+			baseOffset = ((baseOffset + 1) << 7) | int64(b&0x7f)
+		}
+		baseType, base, err = readGitPackObjectAt(objectsDir, pack, offset-baseOffset, hashSize, depth+1)
+	case gitObjectRefDelta:
+		if pos+hashSize > len(header) {
+			return 0, nil, errors.New("truncated git pack object header")
+		}
+		baseHash := hex.EncodeToString(header[pos : pos+hashSize])
+		pos += hashSize
+		baseType, base, err = readGitObjectAtDepth(objectsDir, baseHash, depth+1)
+	case gitObjectCommit, gitObjectTree, gitObjectBlob, gitObjectTag:
+	default:
+		return 0, nil, fmt.Errorf("invalid git pack object type %d", objectType)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	reader, err := zlib.NewReader(io.NewSectionReader(pack, offset+int64(pos), 1<<62))
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid git pack object: %w", err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid git pack object: %w", err)
+	}
+
+	if base == nil {
+		return objectType, data, nil
+	}
+	content, err := applyGitDelta(base, data)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return baseType, content, nil
+}
+
+// Reads a little endian variable length size of a git delta, and returns it with the number of bytes read
+func readGitDeltaSize(delta []byte) (int, int) {
+	size, shift := 0, 0
+	for i, b := range delta {
+		size |= int(b&0x7f) << shift
+		shift += 7
+		if b&0x80 == 0 {
+			return size, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// Applies a git delta to a base object, and returns the resulting content
+// A delta is made of the base size, the result size, then instructions copying ranges of the base or inserting data.
+func applyGitDelta(base []byte, delta []byte) ([]byte, error) {
+	baseSize, n := readGitDeltaSize(delta)
+	if n == 0 || baseSize != len(base) {
+		return nil, errors.New("invalid git delta base size")
+	}
+	delta = delta[n:]
+	resultSize, n := readGitDeltaSize(delta)
+	if n == 0 {
+		return nil, errors.New("invalid git delta result size")
+	}
+	delta = delta[n:]
+
+	result := make([]byte, 0, resultSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			// Copy from the base: offset and size bytes are present according to the bits of the opcode
+			var offset, size int
+			for i := range 7 {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errors.New("truncated git delta")
+				}
+				if i < 4 {
+					offset |= int(delta[0]) << (8 * i)
+				} else {
+					size |= int(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, errors.New("invalid git delta copy")
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			// Insert the following bytes
+			size := int(op)
+			if size > len(delta) {
+				return nil, errors.New("truncated git delta")
+			}
+			result = append(result, delta[:size]...)
+			delta = delta[size:]
+		default:
+			return nil, errors.New("invalid git delta opcode")
+		}
+	}
+	if len(result) != resultSize {
+		return nil, errors.New("invalid git delta result size")
+	}
+
+	return result, nil
+}
+
+// Returns the hash of the tree of a git commit
+func readGitCommitTree(gitRepoPath string, commitHash string) (string, error) {
+	objectType, content, err := readGitObject(gitRepoPath, commitHash)
+	if err != nil {
+		return "", err
+	}
+	if objectType != gitObjectCommit {
+		return "", fmt.Errorf("git object %s is not a commit", commitHash)
+	}
+
+	// The tree is given on the first line of the commit header
+	firstLine, _, _ := strings.Cut(string(content), "\n")
+	treeHash, found := strings.CutPrefix(firstLine, "tree ")
+	if !found {
+		return "", fmt.Errorf("invalid git commit %s", commitHash)
+	}
+
+	return treeHash, nil
+}
+
+// Reads a git tree recursively, and returns its files (including submodules) as index entries
+// Tree entries are made of "<octal mode> <name>\0" followed by the binary hash of the entry. The sub trees whose hash
+// is the known one for their path are not read: they are returned as directory entries.
+func readGitTree(gitRepoPath string, treeHash string, prefix string, knownTrees map[string]string) ([]gitIndexEntry, error) {
+	objectType, content, err := readGitObject(gitRepoPath, treeHash)
+	if err != nil {
+		return nil, err
+	}
+	if objectType != gitObjectTree {
+		return nil, fmt.Errorf("git object %s is not a tree", treeHash)
+	}
+	hashSize := len(treeHash) / 2
+
+	entries := []gitIndexEntry{}
+	for len(content) > 0 {
+		nameEnd := bytes.IndexByte(content, 0)
+		if nameEnd < 0 || nameEnd+1+hashSize > len(content) {
+			return nil, fmt.Errorf("invalid git tree %s", treeHash)
+		}
+		modeString, name, found := strings.Cut(string(content[:nameEnd]), " ")
+		mode, err := strconv.ParseUint(modeString, 8, 32)
+		if !found || err != nil {
+			return nil, fmt.Errorf("invalid git tree %s", treeHash)
+		}
+		entry := gitIndexEntry{
+			path: path.Join(prefix, name),
+			mode: uint32(mode),
+			hash: hex.EncodeToString(content[nameEnd+1 : nameEnd+1+hashSize]),
+		}
+		content = content[nameEnd+1+hashSize:]
+
+		if entry.mode == gitTreeModeDirectory && knownTrees[entry.path] != entry.hash {
+			subEntries, err := readGitTree(gitRepoPath, entry.hash, entry.path, knownTrees)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, subEntries...)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
@@ -23,8 +23,9 @@ package main
 import (
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
+
+	"github.com/mitchellh/go-homedir"
 )
 
 // Enum describing the hook creation state
@@ -38,19 +39,51 @@ const (
 	HookNotMatching
 )
 
+// Name of the git hook the program is installed as
+const preCommitHookName = "pre-commit"
+
+// Tells if the program is running as a git pre-commit hook: either called through the link created by the install
+// command, or called by git with the index file of the commit in the environment
+func isRunningAsGitHook() bool {
+	return filepath.Base(os.Args[0]) == preCommitHookName || os.Getenv("GIT_INDEX_FILE") != ""
+}
+
+// Returns the hooks directory of a git repository: the one set by core.hooksPath in the repository or global git
+// config, else the one of its common directory, shared by all its linked worktrees
+// A relative core.hooksPath is relative to the work tree, or to the git directory for a bare repository.
+func gitHooksDir(gitRepoPath string) string {
+	hooksPath, found := gitCfgValue(loadGitCfgs(gitRepoPath), "core", "hooksPath")
+	if !found || hooksPath == "" {
+		return filepath.Join(gitCommonDir(gitRepoPath), "hooks")
+	}
+
+	if expanded, err := homedir.Expand(hooksPath); err == nil {
+		hooksPath = expanded
+	}
+	base := gitWorkTree(gitRepoPath)
+	if base == "" {
+		base = gitRepoPath
+	}
+	return resolveGitPath(base, hooksPath)
+}
+
+// Returns the path of a hook of a git repository
+func gitHookPath(gitRepoPath string, hookName string) string {
+	return filepath.Join(gitHooksDir(gitRepoPath), hookName)
+}
+
 func createGitHookLink(gitRepoPath string, hookName string) (int, error) {
 	currentExe, err := os.Executable()
 	if err != nil {
 		return HookError, err
 	}
 
-	err = os.MkdirAll(path.Join(gitRepoPath, "hooks"), 0755) // #nosec G301
+	hookPath := gitHookPath(gitRepoPath, hookName)
+	err = os.MkdirAll(filepath.Dir(hookPath), 0755) // #nosec G301
 	if err != nil {
 		return HookError, err
 	}
 
-	hookPath := path.Join(gitRepoPath, "hooks", hookName)
-
 	// There is no hook already
 	fi, err := os.Lstat(hookPath)
 	if os.IsNotExist(err) {
@@ -85,7 +118,7 @@ func createGitHookLink(gitRepoPath string, hookName string) (int, error) {
 }
 
 func deleteGitHookLink(gitRepoPath string, hookName string) (int, error) {
-	hookPath := path.Join(gitRepoPath, "hooks", hookName)
+	hookPath := gitHookPath(gitRepoPath, hookName)
 
 	fi, err := os.Lstat(hookPath)
 	if os.IsNotExist(err) {
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Tells if local includes are read from the working tree and inlined in the content sent to the API
+var inlineLocalIncludes = true
+
+// Maximum depth of nested local includes, as allowed by Gitlab
+const maxIncludeDepth = 150
+
+// A local file included in a gitlab-ci file, whose content was inlined
+type includedFile struct {
+	path    string
+	content []byte
+	root    *yaml.Node
+}
+
+// Returns the paths of included files, as a comma separated list
+func includedFilePaths(included []includedFile) string {
+	paths := make([]string, 0, len(included))
+	for _, file := range included {
+		paths = append(paths, file.path)
+	}
+	return strings.Join(paths, ", ")
+}
+
+// Source of the files of a git repository
+type repositoryFiles interface {
+	// Reads the content of a file, given its path relative to the repository root
+	readFile(relativePath string) ([]byte, error)
+	// Lists the files, as paths relative to the repository root
+	listFiles() ([]string, error)
+}
+
+// Files of the working tree of a git repository
+// The files are listed once, skipping the files ignored by git.
+type workTreeFiles struct {
+	workTree    string
+	gitRepoPath string
+	listOnce    sync.Once
+	list        []string
+	listErr     error
+}
+
+// Creates the source of the files of the working tree of a git repository
+func newWorkTreeFiles(workTree string, gitRepoPath string) *workTreeFiles {
+	return &workTreeFiles{workTree: workTree, gitRepoPath: gitRepoPath}
+}
+
+func (files *workTreeFiles) readFile(relativePath string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(files.workTree, filepath.FromSlash(relativePath))) // #nosec G304
+}
+
+func (files *workTreeFiles) listFiles() ([]string, error) {
+	files.listOnce.Do(func() {
+		files.list = []string{}
+		files.listErr = walkGitWorkTree(files.workTree, files.gitRepoPath, files.workTree, func(_ string, workTreePath string) error {
+			files.list = append(files.list, workTreePath)
+			return nil
+		})
+	})
+
+	return files.list, files.listErr
+}
+
+// Converts a Gitlab include glob (where "*" does not match "/", "**" matches anything, and "**/" matches any number
+// of directories, including none) to a regexp. Bracket expressions like "[a-z]" or "[!0-9]" are supported.
+func includeGlobToRegexp(glob string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			switch {
+			case strings.HasPrefix(glob[i:], "**/"):
+				expr.WriteString("(?:.*/)?")
+				i += 2
+			case strings.HasPrefix(glob[i:], "**"):
+				expr.WriteString(".*")
+				i++
+			default:
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.Compile(expr.String())
+}
+
+// Resolves the path of a local include, which may be a glob, to the paths of the matching files of the repository
+func resolveLocalInclude(files repositoryFiles, include string) ([]string, error) {
+	include = strings.TrimPrefix(include, "/")
+	if !strings.ContainsAny(include, "*?") {
+		return []string{include}, nil
+	}
+
+	re, err := includeGlobToRegexp(include)
+	if err != nil {
+		return nil, err
+	}
+	list, err := files.listFiles()
+	if err != nil {
+		return nil, err
+	}
+	matches := []string{}
+	for _, file := range list {
+		if re.MatchString(file) {
+			matches = append(matches, file)
+		}
+	}
+	sort.Strings(matches)
+
+	return matches, nil
+}
+
+// Returns the path of a local include entry, or an empty string if the entry is not a local include that can be
+// inlined: remote, project, template or component includes, and local includes with rules or inputs, are left to the
+// Gitlab API.
+func localIncludePath(entry *yaml.Node) string {
+	switch entry.Kind {
+	case yaml.ScalarNode:
+		if strings.Contains(entry.Value, "://") {
+			return ""
+		}
+		return entry.Value
+	case yaml.MappingNode:
+		if len(entry.Content) != 2 {
+			return ""
+		}
+		if key, value := findYamlKey(entry, "local"); key != nil && value.Kind == yaml.ScalarNode {
+			return value.Value
+		}
+	}
+
+	return ""
+}
+
+// Returns the entries of the include key of a parsed gitlab-ci file, and the include key index in the root mapping
+func includeEntries(root *yaml.Node) ([]*yaml.Node, int) {
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "include" {
+			continue
+		}
+		value := root.Content[i+1]
+		if value.Kind == yaml.SequenceNode {
+			return value.Content, i
+		}
+		return []*yaml.Node{value}, i
+	}
+
+	return nil, -1
+}
+
+// Deep merges a mapping node into another one: values of src override the ones of dst, except mappings that are merged
+func mergeYamlMappings(dst *yaml.Node, src *yaml.Node) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			if dst.Content[j].Value != key.Value {
+				continue
+			}
+			found = true
+			if dst.Content[j+1].Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+				mergeYamlMappings(dst.Content[j+1], value)
+			} else {
+				dst.Content[j+1] = value
+			}
+			break
+		}
+		if !found {
+			dst.Content = append(dst.Content, key, value)
+		}
+	}
+}
+
+// Returns a copy of a node where the aliases are replaced by copies of their anchored node, and the merge keys by the
+// merged entries
+// Anchors are local to a file: resolving them before merging files prevents an alias from referencing the anchor of
+// another file.
+func resolveYamlAliases(node *yaml.Node, resolving map[*yaml.Node]bool) (*yaml.Node, error) {
+	if node.Kind == yaml.AliasNode {
+		if resolving[node.Alias] {
+			return nil, fmt.Errorf("anchor '%s' references itself", node.Value)
+		}
+		resolving[node.Alias] = true
+		defer delete(resolving, node.Alias)
+		return resolveYamlAliases(node.Alias, resolving)
+	}
+
+	resolved := *node
+	resolved.Anchor = ""
+	resolved.Content = make([]*yaml.Node, 0, len(node.Content))
+	merges := []*yaml.Node{}
+	for i := 0; i < len(node.Content); i++ {
+		child, err := resolveYamlAliases(node.Content[i], resolving)
+		if err != nil {
+			return nil, err
+		}
+		if node.Kind == yaml.MappingNode && i%2 == 0 && child.Tag == "!!merge" && i+1 < len(node.Content) {
+			value, err := resolveYamlAliases(node.Content[i+1], resolving)
+			if err != nil {
+				return nil, err
+			}
+			if value.Kind == yaml.SequenceNode {
+				merges = append(merges, value.Content...)
+			} else {
+				merges = append(merges, value)
+			}
+			i++
+			continue
+		}
+		resolved.Content = append(resolved.Content, child)
+	}
+
+	// The entries of the mapping override the merged ones, the first merged mappings overriding the next ones
+	for _, merge := range merges {
+		if merge.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: merge of a non mapping value", merge.Line)
+		}
+		for i := 0; i+1 < len(merge.Content); i += 2 {
+			if key, _ := findYamlKey(&resolved, merge.Content[i].Value); key == nil {
+				resolved.Content = append(resolved.Content, merge.Content[i], merge.Content[i+1])
+			}
+		}
+	}
+
+	return &resolved, nil
+}
+
+// Inliner of the local includes of a gitlab-ci file
+type includeInliner struct {
+	files    repositoryFiles
+	visited  map[string]bool
+	included []includedFile
+}
+
+// Resolves the local includes of a parsed gitlab-ci file: returns a new root mapping, with the inlined files merged and
+// the other includes kept
+func (inliner *includeInliner) inline(root *yaml.Node, depth int) (*yaml.Node, error) {
+	root, err := resolveYamlAliases(root, map[*yaml.Node]bool{})
+	if err != nil {
+		return nil, err
+	}
+	entries, includeIndex := includeEntries(root)
+	if includeIndex < 0 {
+		return root, nil
+	}
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("too many nested includes (maximum is %d)", maxIncludeDepth)
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	keptEntries := []*yaml.Node{}
+	for _, entry := range entries {
+		includePath := localIncludePath(entry)
+		if includePath == "" {
+			keptEntries = append(keptEntries, entry)
+			continue
+		}
+		files, err := resolveLocalInclude(inliner.files, includePath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resolve local include '%s': %w", includePath, err)
+		}
+		for _, file := range files {
+			if inliner.visited[file] {
+				continue
+			}
+			content, err := inliner.files.readFile(file)
+			if err != nil {
+				// Let the Gitlab API report the missing file
+				keptEntries = append(keptEntries, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "/" + file})
+				continue
+			}
+			includedRoot, header := parseCiFileDocuments(content)
+			if includedRoot == nil || header != nil {
+				// Let the Gitlab API report the invalid file, or interpolate the inputs declared in the header
+				keptEntries = append(keptEntries, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "/" + file})
+				continue
+			}
+			inliner.visited[file] = true
+			inliner.included = append(inliner.included, includedFile{path: file, content: content, root: includedRoot})
+
+			// Inlining works on a copy, as the merge modifies the nodes
+			resolved, err := inliner.inline(includedRoot, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			// Includes that are not inlined are gathered, not overridden
+			if nestedEntries, nestedIndex := includeEntries(resolved); nestedIndex >= 0 {
+				keptEntries = append(keptEntries, nestedEntries...)
+				resolved.Content = append(resolved.Content[:nestedIndex:nestedIndex], resolved.Content[nestedIndex+2:]...)
+			}
+			mergeYamlMappings(merged, resolved)
+		}
+	}
+
+	// The including file overrides the included ones
+	local := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	local.Content = append(local.Content, root.Content[:includeIndex]...)
+	local.Content = append(local.Content, root.Content[includeIndex+2:]...)
+	mergeYamlMappings(merged, local)
+
+	if len(keptEntries) > 0 {
+		mergeYamlMappings(merged, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "include"},
+			{Kind: yaml.SequenceNode, Tag: "!!seq", Content: keptEntries},
+		}})
+	}
+
+	return merged, nil
+}
+
+// Inlines the content of the local includes of a gitlab-ci file, read from the given repository files
+// Returns the content to send to the Gitlab API, and the inlined files. If no local include is inlined, the content is
+// returned unchanged. Files declaring inputs in a `spec:` header are not inlined, the Gitlab API interpolating them.
+func inlineGitlabCiLocalIncludes(content []byte, files repositoryFiles) ([]byte, []includedFile, error) {
+	root, header := parseCiFileDocuments(content)
+	if root == nil || header != nil {
+		return content, nil, nil
+	}
+
+	inliner := &includeInliner{files: files, visited: map[string]bool{}}
+	merged, err := inliner.inline(root, 0)
+	if err != nil {
+		return content, nil, err
+	}
+	if len(inliner.included) == 0 {
+		return content, nil, nil
+	}
+
+	var buf strings.Builder
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(merged); err != nil {
+		return content, nil, fmt.Errorf("unable to encode inlined content: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return content, nil, fmt.Errorf("unable to encode inlined content: %w", err)
+	}
+
+	return []byte(buf.String()), inliner.included, nil
+}
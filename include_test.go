@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Repository files held in memory
+type memoryFiles map[string]string
+
+func (files memoryFiles) readFile(relativePath string) ([]byte, error) {
+	content, ok := files[relativePath]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return []byte(content), nil
+}
+
+func (files memoryFiles) listFiles() ([]string, error) {
+	list := []string{}
+	for path := range files {
+		list = append(list, path)
+	}
+	return list, nil
+}
+
+func TestInlineGitlabCiLocalIncludes(t *testing.T) {
+	files := memoryFiles{
+		".gitlab/ci/build.yml":         "variables:\n  A: build\n  B: build\nbuild:\n  script: make\n",
+		".gitlab/ci/deploy.yml":        "include: /.gitlab/ci/nested/common.yml\ndeploy:\n  script: deploy\n",
+		".gitlab/ci/nested/common.yml": "include:\n  - template: Security/SAST.gitlab-ci.yml\n.common:\n  image: alpine\n",
+	}
+	content := `include:
+  - local: /.gitlab/ci/*.yml
+  - remote: https://example.com/ci.yml
+  - local: /.gitlab/ci/rules.yml
+    rules:
+      - if: $CI_COMMIT_TAG
+variables:
+  A: main
+build:
+  stage: test
+`
+
+	inlined, included, err := inlineGitlabCiLocalIncludes([]byte(content), files)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if paths := includedFilePaths(included); paths != ".gitlab/ci/build.yml, .gitlab/ci/deploy.yml, .gitlab/ci/nested/common.yml" {
+		t.Errorf("received included files '%s'", paths)
+	}
+
+	var result struct {
+		Include   []any             `yaml:"include"`
+		Variables map[string]string `yaml:"variables"`
+		Build     map[string]string `yaml:"build"`
+		Deploy    map[string]string `yaml:"deploy"`
+		Common    map[string]string `yaml:".common"`
+	}
+	if err := yaml.Unmarshal(inlined, &result); err != nil {
+		t.Fatalf("unable to parse inlined content: %s", err)
+	}
+
+	if result.Variables["A"] != "main" || result.Variables["B"] != "build" {
+		t.Errorf("variables are not deep merged with the main file precedence: %v", result.Variables)
+	}
+	if result.Build["stage"] != "test" || result.Build["script"] != "make" {
+		t.Errorf("build job is not deep merged: %v", result.Build)
+	}
+	if result.Deploy["script"] != "deploy" || result.Common["image"] != "alpine" {
+		t.Errorf("nested includes are not inlined")
+	}
+	if len(result.Include) != 3 {
+		t.Errorf("received %d includes while expecting the 3 includes that can't be inlined: %v", len(result.Include), result.Include)
+	}
+}
+
+func TestInlineGitlabCiLocalIncludesWithoutLocalInclude(t *testing.T) {
+	content := "include:\n  - remote: https://example.com/ci.yml\nbuild:\n    script: make\n"
+
+	inlined, included, err := inlineGitlabCiLocalIncludes([]byte(content), memoryFiles{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(included) != 0 || string(inlined) != content {
+		t.Errorf("content should be unchanged when no local include is inlined, received '%s'", inlined)
+	}
+}
+
+func TestInlineGitlabCiLocalIncludesWithSpecHeader(t *testing.T) {
+	files := memoryFiles{
+		"ci/build.yml":  "build:\n  script: make\n",
+		"ci/deploy.yml": "spec:\n  inputs:\n    environment:\n      default: prod\n---\ndeploy:\n  script: deploy $[[ inputs.environment ]]\n",
+	}
+	content := "include:\n  - local: /ci/build.yml\n  - local: /ci/deploy.yml\n"
+
+	inlined, included, err := inlineGitlabCiLocalIncludes([]byte(content), files)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if paths := includedFilePaths(included); paths != "ci/build.yml" {
+		t.Errorf("received included files '%s'", paths)
+	}
+	var result struct {
+		Include []any          `yaml:"include"`
+		Build   map[string]any `yaml:"build"`
+	}
+	if err := yaml.Unmarshal(inlined, &result); err != nil {
+		t.Fatalf("unable to parse inlined content: %s", err)
+	}
+	if result.Build["script"] != "make" {
+		t.Errorf("received build job %v", result.Build)
+	}
+	if len(result.Include) != 1 {
+		t.Errorf("the file with a spec header should be kept as an include, received %v", result.Include)
+	}
+
+	// The body of a file with a spec header is the root
+	root := parseCiFileContent([]byte(files["ci/deploy.yml"]))
+	if _, value := findYamlKey(root, "deploy"); value == nil {
+		t.Errorf("the body of the file with a spec header should be parsed")
+	}
+	if root := parseCiFileContent([]byte("a: 1\n---\nb: 2\n")); root != nil {
+		t.Errorf("a file made of several documents without a spec header should not be parsed")
+	}
+}
+
+func TestInlineGitlabCiLocalIncludesWithAnchors(t *testing.T) {
+	files := memoryFiles{
+		"ci/build.yml":  ".defaults: &defaults\n  image: golang\nbuild:\n  <<: *defaults\n  script: make\n",
+		"ci/deploy.yml": ".defaults: &defaults\n  image: alpine\n  tags: [deploy]\ndeploy:\n  <<: *defaults\n  script: deploy\n",
+	}
+	content := "include:\n  - local: /ci/*.yml\n.defaults: &defaults\n  image: node\ntest:\n  <<: *defaults\n  script: test\n"
+	inlined, _, err := inlineGitlabCiLocalIncludes([]byte(content), files)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var result map[string]struct {
+		Image  string   `yaml:"image"`
+		Tags   []string `yaml:"tags"`
+		Script string   `yaml:"script"`
+	}
+	if err := yaml.Unmarshal(inlined, &result); err != nil {
+		t.Fatalf("unable to parse inlined content: %s", err)
+	}
+	for job, image := range map[string]string{"build": "golang", "deploy": "alpine", "test": "node"} {
+		if result[job].Image != image {
+			t.Errorf("job %s: received image '%s' while expecting '%s'", job, result[job].Image, image)
+		}
+	}
+	if len(result["build"].Tags) != 0 || len(result["deploy"].Tags) != 1 {
+		t.Errorf("received tags %v for build and %v for deploy", result["build"].Tags, result["deploy"].Tags)
+	}
+
+	if _, _, err := inlineGitlabCiLocalIncludes([]byte("include: /ci/build.yml\na: &a [*a]\n"), files); err == nil {
+		t.Errorf("an error should be returned for a recursive anchor")
+	}
+}
+
+func TestWorkTreeFilesList(t *testing.T) {
+	root := t.TempDir()
+	createTestFiles(t, root, map[string]string{
+		".git/config":                  "",
+		".gitignore":                   "node_modules/\n*.log\n",
+		"ci/build.yml":                 "",
+		"ci/debug.log":                 "",
+		"node_modules/pkg/ci/test.yml": "",
+	})
+
+	files := newWorkTreeFiles(root, filepath.Join(root, ".git"))
+	list, err := files.listFiles()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if received := strings.Join(list, ","); received != ".gitignore,ci/build.yml" {
+		t.Errorf("received files '%s'", received)
+	}
+
+	// The files are listed once
+	createTestFiles(t, root, map[string]string{"ci/deploy.yml": ""})
+	if list, _ := files.listFiles(); len(list) != 2 {
+		t.Errorf("received files %v, while expecting the first listing", list)
+	}
+}
+
+var includeGlobToRegexpData = []struct {
+	glob    string
+	path    string
+	matches bool
+}{
+	{".gitlab/ci/*.yml", ".gitlab/ci/build.yml", true},
+	{".gitlab/ci/*.yml", ".gitlab/ci/nested/build.yml", false},
+	{".gitlab/ci/**.yml", ".gitlab/ci/nested/build.yml", true},
+	{".gitlab/ci/**/*.yml", ".gitlab/ci/nested/build.yml", true},
+	{"ci/job-?.yml", "ci/job-1.yml", true},
+	{"ci/job-?.yml", "ci/job-12.yml", false},
+	{"ci/*.yml", "ci/build.yaml", false},
+	{"**/*.gitlab-ci.yml", "deploy.gitlab-ci.yml", true},
+	{"**/*.gitlab-ci.yml", "services/api/deploy.gitlab-ci.yml", true},
+	{"ci/job-[0-9].yml", "ci/job-1.yml", true},
+	{"ci/job-[!0-9].yml", "ci/job-1.yml", false},
+}
+
+func TestIncludeGlobToRegexp(t *testing.T) {
+	for _, testData := range includeGlobToRegexpData {
+		t.Run("glob="+testData.glob+",path="+testData.path, func(t *testing.T) {
+			re, err := includeGlobToRegexp(testData.glob)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if re.MatchString(testData.path) != testData.matches {
+				t.Errorf("received match %v while expecting %v", !testData.matches, testData.matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Name of the JUnit test suites element
+const junitTestSuitesName = "gitlab-ci-linter"
+
+// JUnitTestSuites struct represents the root element of a JUnit XML report
+type JUnitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []JUnitTestSuite `xml:"testsuite"`
+}
+
+// JUnitTestSuite struct represents a JUnit test suite, one for each checked gitlab-ci file
+type JUnitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []JUnitTestCase `xml:"testcase"`
+}
+
+// JUnitTestCase struct represents a JUnit test case, one for each lint error or warning
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Line      int           `xml:"line,attr,omitempty"`
+	Time      string        `xml:"time,attr"`
+	Failure   *JUnitMessage `xml:"failure,omitempty"`
+	Error     *JUnitMessage `xml:"error,omitempty"`
+	Skipped   *JUnitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// JUnitMessage struct represents the failure, error or skipped element of a JUnit test case
+type JUnitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Content string `xml:",chardata"`
+}
+
+// Formats a duration in milliseconds as JUnit seconds
+func junitTime(durationMs int64) string {
+	return fmt.Sprintf("%.3f", float64(durationMs)/1000)
+}
+
+// Builds the JUnit test suite of a check result
+// Each lint error is a failed test case, each warning a skipped one (or a failed one with --fail-on-warnings).
+// A valid file gives a passed test case, and a check that could not complete gives a test case in error.
+func newJUnitTestSuite(result *CheckResult) JUnitTestSuite {
+	suite := JUnitTestSuite{
+		Name:      result.File,
+		Time:      junitTime(result.DurationMs),
+		Timestamp: result.StartedAt.Format("2006-01-02T15:04:05"),
+		TestCases: []JUnitTestCase{},
+	}
+
+	newTestCase := func(name string, msg LintMessage) JUnitTestCase {
+		return JUnitTestCase{Name: name, ClassName: result.File, File: msg.location(result.File), Line: msg.Line, Time: suite.Time}
+	}
+
+	if result.Error != "" {
+		testCase := newTestCase("lint", LintMessage{})
+		testCase.Error = &JUnitMessage{Message: result.Error, Type: "check error", Content: result.Error}
+		suite.TestCases = append(suite.TestCases, testCase)
+		suite.Errors++
+	} else if result.Valid && len(result.Errors) == 0 {
+		suite.TestCases = append(suite.TestCases, newTestCase("valid configuration", LintMessage{}))
+	}
+
+	for _, msg := range result.Messages {
+		testCase := newTestCase(msg.Message, msg)
+		switch {
+		case msg.Severity == lintSeverityError:
+			testCase.Failure = &JUnitMessage{Message: msg.Message, Type: "lint error", Content: msg.compilerStyle(result.File)}
+			suite.Failures++
+		case failOnWarnings:
+			testCase.Failure = &JUnitMessage{Message: msg.Message, Type: "lint warning", Content: msg.compilerStyle(result.File)}
+			suite.Failures++
+		default:
+			testCase.Skipped = &JUnitMessage{Message: msg.Message, Type: "lint warning"}
+			testCase.SystemOut = msg.compilerStyle(result.File)
+			suite.Skipped++
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	suite.Tests = len(suite.TestCases)
+
+	return suite
+}
+
+// Writes a JUnit XML report of check results, with one test suite per checked file
+func writeJUnitReport(w io.Writer, results []*CheckResult) error {
+	report := JUnitTestSuites{
+		Name:   junitTestSuitesName,
+		Suites: []JUnitTestSuite{},
+	}
+
+	var durationMs int64
+	for _, result := range results {
+		suite := newJUnitTestSuite(result)
+		report.Suites = append(report.Suites, suite)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Errors += suite.Errors
+		report.Skipped += suite.Skipped
+		durationMs += result.DurationMs
+	}
+	report.Time = junitTime(durationMs)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("unable to encode JUnit report: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
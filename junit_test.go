@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+)
+
+func TestWriteJUnitReport(t *testing.T) {
+	invalid := newCheckResult(".gitlab-ci.yml")
+	invalid.setLintResponse(GitlabAPILintResponse{
+		Errors:   []string{"jobs:build:script config should be an array", "root config contains unknown keys: foo"},
+		Warnings: []string{"jobs:test may allow multiple pipelines to run for a single action"},
+	})
+	valid := newCheckResult("ci/child.yml")
+	valid.setLintResponse(GitlabAPILintResponse{Valid: true})
+
+	var buf bytes.Buffer
+	if err := writeJUnitReport(&buf, []*CheckResult{invalid, valid}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var report JUnitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("unable to decode JUnit report: %s", err)
+	}
+
+	if len(report.Suites) != 2 {
+		t.Fatalf("received %d test suites while expecting 2", len(report.Suites))
+	}
+	if report.Tests != 4 || report.Failures != 2 || report.Skipped != 1 || report.Errors != 0 {
+		t.Errorf("received totals tests=%d failures=%d skipped=%d errors=%d while expecting 4, 2, 1, 0",
+			report.Tests, report.Failures, report.Skipped, report.Errors)
+	}
+
+	suite := report.Suites[0]
+	if suite.Name != ".gitlab-ci.yml" {
+		t.Errorf("received test suite name '%s' while expecting '.gitlab-ci.yml'", suite.Name)
+	}
+	if suite.TestCases[0].Failure == nil || suite.TestCases[0].Failure.Message != invalid.Errors[0] {
+		t.Errorf("first test case should be a failure for '%s'", invalid.Errors[0])
+	}
+	if suite.TestCases[2].Skipped == nil || suite.TestCases[2].Skipped.Message != invalid.Warnings[0] {
+		t.Errorf("last test case should be skipped for '%s'", invalid.Warnings[0])
+	}
+
+	if len(report.Suites[1].TestCases) != 1 || report.Suites[1].Failures != 0 {
+		t.Errorf("a valid file should have a single passed test case")
+	}
+}
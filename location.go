@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severities of lint messages
+const (
+	lintSeverityError   = "error"
+	lintSeverityWarning = "warning"
+)
+
+// Position of a region in a file, as found in some lint messages like YAML syntax errors
+var lintMessagePositionPattern = regexp.MustCompile(`(?i)\bline (\d+) column (\d+)\b`)
+
+// List of unknown keys, as found in lint messages like "jobs:build config contains unknown keys: foo, bar"
+var lintMessageUnknownKeysPattern = regexp.MustCompile(`contains unknown keys?: (.+)$`)
+
+// Job name, as found in lint messages like "build job: undefined need: test"
+var lintMessageJobPattern = regexp.MustCompile(`^(.+?) job: `)
+
+// Texts following the key path in lint messages, like " config " in "jobs:build:script config should be an array"
+var lintMessageKeyPathSuffixes = []string{
+	" config ", " job ", " may allow ", " chosen stage ", " dependencies ", " needs ", " should ", " can't ", " is ",
+	" has ", " when ", " if ", " unknown ", " invalid ",
+}
+
+// LintMessage struct represents a lint error or warning, with its position in the checked file if it was found
+type LintMessage struct {
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+// Returns the message in a compiler-like style: "file:line:column: severity: message", or "file: severity: message"
+// if its position is unknown
+// The given file is the checked file, used unless the message is located in an included file.
+func (m LintMessage) compilerStyle(file string) string {
+	file = m.location(file)
+	if m.Line > 0 {
+		return file + ":" + strconv.Itoa(m.Line) + ":" + strconv.Itoa(m.Column) + ": " + m.Severity + ": " + m.Message
+	}
+	return file + ": " + m.Severity + ": " + m.Message
+}
+
+// Returns the file the message is located in: the given checked file, or the included file it was found in
+func (m LintMessage) location(file string) string {
+	if m.File != "" {
+		return m.File
+	}
+	return file
+}
+
+// Parses the content of a gitlab-ci file, and returns its root node
+// Returns nil if the content is not a valid YAML mapping.
+func parseCiFileContent(content []byte) *yaml.Node {
+	root, _ := parseCiFileDocuments(content)
+	return root
+}
+
+// Parses the content of a gitlab-ci file, and returns its root node and its header node
+// The header is the `spec:` document that precedes the body of files declaring inputs, nil if there is none. The root
+// node is nil if the content is not a valid YAML mapping, or is made of other documents than a header and a body.
+func parseCiFileDocuments(content []byte) (*yaml.Node, *yaml.Node) {
+	documents := []*yaml.Node{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, nil
+		}
+		if document.Kind != yaml.DocumentNode || len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+			return nil, nil
+		}
+		documents = append(documents, document.Content[0])
+	}
+
+	switch len(documents) {
+	case 1:
+		return documents[0], nil
+	case 2:
+		header := documents[0]
+		if len(header.Content) != 2 || header.Content[0].Value != "spec" {
+			return nil, nil
+		}
+		return documents[1], header
+	default:
+		return nil, nil
+	}
+}
+
+// Returns the key and value nodes of a key in a mapping node, or nil if not found
+func findYamlKey(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+
+	return nil, nil
+}
+
+// Returns the key path a lint message refers to, e.g. ["build", "script"] for
+// "jobs:build:script config should be an array", or an empty path for "root config ..."
+// The key path ends before one of the known message suffixes, so that job names with spaces are kept whole: the key
+// path found the deepest in the file is used, else the first word of the message.
+// The returned boolean is false if the message does not refer to a key path.
+func lintMessageKeyPath(root *yaml.Node, msg string) ([]string, bool) {
+	if matches := lintMessageJobPattern.FindStringSubmatch(msg); matches != nil {
+		return []string{matches[1]}, true
+	}
+
+	tokens := []string{}
+	for _, suffix := range lintMessageKeyPathSuffixes {
+		for offset := 0; ; {
+			index := strings.Index(msg[offset:], suffix)
+			if index < 0 {
+				break
+			}
+			// A key path has no ": " separator, unlike the message text
+			if token := msg[:offset+index]; token != "root" && !strings.Contains(token, ": ") {
+				tokens = append(tokens, token)
+			}
+			offset += index + 1
+		}
+	}
+	// The shortest key path wins among the ones found as deep
+	sort.SliceStable(tokens, func(i, j int) bool { return len(tokens[i]) < len(tokens[j]) })
+	var bestKeyPath []string
+	bestDepth := 0
+	for _, token := range tokens {
+		keyPath := splitLintMessageKeyPath(token)
+		if depth := yamlKeyPathDepth(root, keyPath); depth > bestDepth {
+			bestKeyPath, bestDepth = keyPath, depth
+		}
+	}
+	if bestKeyPath != nil {
+		return bestKeyPath, true
+	}
+
+	token, _, _ := strings.Cut(msg, " ")
+	token = strings.TrimSuffix(token, ":")
+	if token == "root" {
+		return []string{}, true
+	}
+
+	keyPath := splitLintMessageKeyPath(token)
+	if len(keyPath) == 1 {
+		// A single word is a key path only if it is an existing top-level key
+		if key, _ := findYamlKey(root, token); key == nil {
+			return nil, false
+		}
+	}
+
+	return keyPath, true
+}
+
+// Splits the key path of a lint message, e.g. "jobs:build:script", into its keys
+func splitLintMessageKeyPath(token string) []string {
+	keyPath := strings.Split(token, ":")
+	if len(keyPath) > 1 && keyPath[0] == "jobs" {
+		// Jobs are top-level keys of the file
+		keyPath = keyPath[1:]
+	}
+	return keyPath
+}
+
+// Returns the number of keys of a key path found in a mapping node, following the aliases
+func yamlKeyPathDepth(mapping *yaml.Node, keyPath []string) int {
+	node := mapping
+	for depth, key := range keyPath {
+		_, valueNode := findYamlKey(node, key)
+		if valueNode == nil {
+			return depth
+		}
+		node = valueNode
+		for node.Kind == yaml.AliasNode && node.Alias != nil {
+			node = node.Alias
+		}
+	}
+	return len(keyPath)
+}
+
+// Returns the line and column given in a lint message, like a YAML syntax error, and tells if there is one
+func lintMessagePosition(msg string) (int, int, bool) {
+	matches := lintMessagePositionPattern.FindStringSubmatch(msg)
+	if matches == nil {
+		return 0, 0, false
+	}
+	line, _ := strconv.Atoi(matches[1])
+	column, _ := strconv.Atoi(matches[2])
+	return line, column, true
+}
+
+// Finds the line and column, in a parsed gitlab-ci file, that a lint message refers to, and the number of keys of the
+// message key path that were found
+// Returns 0, 0, 0 if the position can not be found.
+func findLintMessagePosition(root *yaml.Node, msg string) (int, int, int) {
+	if root == nil {
+		return 0, 0, 0
+	}
+
+	keyPath, ok := lintMessageKeyPath(root, msg)
+	if !ok {
+		return 0, 0, 0
+	}
+
+	// Go as deep as possible in the key path
+	line, column := root.Line, root.Column
+	node := root
+	depth := 0
+	for i, key := range keyPath {
+		keyNode, valueNode := findYamlKey(node, key)
+		if keyNode == nil {
+			if i == 0 {
+				return 0, 0, 0
+			}
+			break
+		}
+		line, column = keyNode.Line, keyNode.Column
+		depth++
+		node = valueNode
+		// Follow aliases, to locate keys of anchored mappings
+		for node.Kind == yaml.AliasNode && node.Alias != nil {
+			node = node.Alias
+		}
+	}
+
+	// Locate the first unknown key, if any
+	if matches := lintMessageUnknownKeysPattern.FindStringSubmatch(msg); matches != nil {
+		unknownKey, _, _ := strings.Cut(matches[1], ",")
+		if keyNode, _ := findYamlKey(node, strings.TrimSpace(unknownKey)); keyNode != nil {
+			line, column = keyNode.Line, keyNode.Column
+			depth++
+		}
+	}
+
+	return line, column, depth
+}
+
+// Finds the positions of lint messages in the content of the checked gitlab-ci file
+// Messages are also searched in the inlined included files, whose paths are relative to the given repository working
+// tree: the file where the message key path is found the deepest is used, the checked file having precedence.
+// The positions given in the messages are used only if the content sent to the API was the checked file one: they
+// refer to the generated content otherwise.
+func locateLintMessages(content []byte, messages []LintMessage, included []includedFile, workTree string, sentAsIs bool) {
+	root := parseCiFileContent(content)
+	for i := range messages {
+		if line, column, found := lintMessagePosition(messages[i].Message); found {
+			if sentAsIs {
+				messages[i].Line, messages[i].Column = line, column
+			}
+			continue
+		}
+		line, column, depth := findLintMessagePosition(root, messages[i].Message)
+		for _, file := range included {
+			includedLine, includedColumn, includedDepth := findLintMessagePosition(file.root, messages[i].Message)
+			if includedLine > 0 && (line == 0 || includedDepth > depth) {
+				line, column, depth = includedLine, includedColumn, includedDepth
+				messages[i].File = displayFilePath(filepath.Join(workTree, filepath.FromSlash(file.path)))
+			}
+		}
+		messages[i].Line, messages[i].Column = line, column
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+)
+
+const locateLintMessageContent = `stages:
+  - build
+
+.template: &template
+  image: alpine
+  foo: bar
+
+build:
+  <<: *template
+  stage: build
+  script: make
+
+test job:
+  script:
+    - make test
+  unknown: true
+`
+
+var locateLintMessageData = []struct {
+	msg    string
+	line   int
+	column int
+}{
+	{"jobs:build:script config should be an array", 11, 3},
+	{"jobs:build:stage config should be a string", 10, 3},
+	{"jobs:build:artifacts config should be a hash", 8, 1},
+	{"jobs:test job config contains unknown keys: unknown", 16, 3},
+	{"jobs:test job:script config should be an array", 14, 3},
+	{"jobs:test job may allow multiple pipelines to run for a single action", 13, 1},
+	{"test job job: undefined need: build", 13, 1},
+	{"root config contains unknown keys: stages", 1, 1},
+	{"stages config should be an array of strings", 1, 1},
+	{"jobs:.template config contains unknown keys: foo", 6, 3},
+	{"(<unknown>): did not find expected key while parsing a block mapping at line 3 column 5", 3, 5},
+	{"Local file `ci/build.yml` does not exist!", 0, 0},
+	{"jobs:deploy config should implement a script: or a trigger: keyword", 0, 0},
+}
+
+func TestLocateLintMessage(t *testing.T) {
+	for _, testData := range locateLintMessageData {
+		t.Run("msg="+testData.msg, func(t *testing.T) {
+			messages := []LintMessage{{Severity: lintSeverityError, Message: testData.msg}}
+			locateLintMessages([]byte(locateLintMessageContent), messages, nil, "", true)
+			if messages[0].Line != testData.line || messages[0].Column != testData.column {
+				t.Errorf("received %d:%d while expecting %d:%d", messages[0].Line, messages[0].Column, testData.line, testData.column)
+			}
+		})
+	}
+}
+
+func TestLintMessageCompilerStyle(t *testing.T) {
+	msg := LintMessage{Severity: lintSeverityError, Message: "jobs:build:script config should be an array", Line: 11, Column: 3}
+	expected := ".gitlab-ci.yml:11:3: error: jobs:build:script config should be an array"
+	if received := msg.compilerStyle(".gitlab-ci.yml"); received != expected {
+		t.Errorf("received '%s' while expecting '%s'", received, expected)
+	}
+
+	msg = LintMessage{Severity: lintSeverityWarning, Message: "Local file `ci/build.yml` does not exist!"}
+	expected = ".gitlab-ci.yml: warning: Local file `ci/build.yml` does not exist!"
+	if received := msg.compilerStyle(".gitlab-ci.yml"); received != expected {
+		t.Errorf("received '%s' while expecting '%s'", received, expected)
+	}
+}
+
+func TestLocateLintMessagesOfGeneratedContent(t *testing.T) {
+	msg := "(<unknown>): did not find expected key while parsing a block mapping at line 3 column 5"
+
+	messages := []LintMessage{{Severity: lintSeverityError, Message: msg}}
+	locateLintMessages([]byte(locateLintMessageContent), messages, nil, "", true)
+	if messages[0].Line != 3 || messages[0].Column != 5 {
+		t.Errorf("received %d:%d while expecting 3:5 for content sent as is", messages[0].Line, messages[0].Column)
+	}
+
+	messages = []LintMessage{{Severity: lintSeverityError, Message: msg}}
+	locateLintMessages([]byte(locateLintMessageContent), messages, nil, "", false)
+	if messages[0].Line != 0 || messages[0].Column != 0 {
+		t.Errorf("received %d:%d while expecting no position for generated content", messages[0].Line, messages[0].Column)
+	}
+}
@@ -29,6 +29,7 @@ import (
 	"strings"
 
 	"github.com/fatih/color"
+	"github.com/mitchellh/go-homedir"
 	"github.com/urfave/cli/v2"
 	"gitlab.com/orobardet/gitlab-ci-linter/config"
 )
@@ -38,7 +39,7 @@ var gitlabRootURL string
 
 // The full path of the gitlab-ci file to check, if given at calls.
 // If no path is given at call, the variable will be an empty string, and the program will search for the file
-// using gitlabCiFileName.
+// using gitlabCiFilePatterns, or the CI configuration path of the Gitlab project.
 // Search start on the directoryRoot, and goes up in the directory hierarchy until a file is found or the root is reach
 var gitlabCiFilePath string
 
@@ -60,6 +61,10 @@ var projectPath string
 // The identifier of the GitLab project that is used in the API endpoint to validate the CI configuration.
 var projectID string
 
+// Name of the git remote identifying the Gitlab project
+// If empty, the upstream remote of the current branch, then origin, then any remote answering as a Gitlab are tried.
+var gitRemoteName string
+
 // Timeout in seconds for HTTP request to the Gitlab API
 // Request will fail if lasting more than the timeout
 var httpRequestTimeout int64 = 15
@@ -79,6 +84,9 @@ var dryRun = false
 // When dry_run is true, sets the branch or tag context to use to validate the CI/CD YAML configuration. Defaults to the project’s default branch when not set.
 var dryRunRef string
 
+// Maximum number of gitlab-ci files checked at the same time
+var checkConcurrency = 4
+
 // Analyse a PATH argument, that can be a directory or file, to use it as a gitlab-ci file a a directory
 // where to start searching
 func processPathArgument(path string) {
@@ -87,12 +95,12 @@ func processPathArgument(path string) {
 		if fileInfo.IsDir() {
 			directoryRoot, _ = filepath.Abs(path)
 			if verboseMode {
-				fmt.Printf("%s directory used as repository root.\n", path)
+				fmt.Fprintf(messageOutput, "%s directory used as repository root.\n", path)
 			}
 		} else {
 			gitlabCiFilePath, _ = filepath.Abs(path)
 			if verboseMode {
-				fmt.Printf("%s used as gitlab-ci.yml file.\n", path)
+				fmt.Fprintf(messageOutput, "%s used as gitlab-ci.yml file.\n", path)
 			}
 		}
 	}
@@ -152,8 +160,14 @@ Usage:
     - if a directory, it will be used as the folder from where to search for a ci file and a git repository (similar to global --directory option)
    PATH have precedence over --ci-file and --directory options.`
 
-	app.ArgsUsage = "[PATH]"
-	app.Description = pathArgumentDescription
+	checkPathArgumentDescription := `Any number of PATH can be given, each one depending of its type on filesystem:
+    - if a file, it will be used as a gitlab-ci file to check
+    - if a directory, it will be used as the folder from where to search for a ci file
+   Files are checked concurrently (see --concurrency), and their results displayed in the order of the arguments.
+   If no PATH is given, the --ci-file is checked, or a ci file is searched from --directory.`
+
+	app.ArgsUsage = "[PATH...]"
+	app.Description = checkPathArgumentDescription
 	app.Flags = []cli.Flag{
 		&cli.StringFlag{
 			Name:        "gitlab-url",
@@ -170,6 +184,12 @@ Usage:
 			EnvVars:     []string{"GCL_GITLAB_CI_FILE"},
 			Destination: &gitlabCiFilePath,
 		},
+		&cli.StringSliceFlag{
+			Name:    "ci-file-pattern",
+			Value:   cli.NewStringSlice(gitlabCiFilePatterns...),
+			Usage:   "filename `PATTERN` of the gitlab-ci file to search for, when its path is not given and the Gitlab project does not define a custom CI configuration path. Can be repeated, patterns are tried in order",
+			EnvVars: []string{"GCL_CI_FILE_PATTERNS"},
+		},
 		&cli.StringFlag{
 			Name:        "directory",
 			Aliases:     []string{"d"},
@@ -216,6 +236,20 @@ Usage:
 			EnvVars:     []string{"CI_PROJECT_ID", "GCL_PROJECT_ID"},
 			Destination: &projectID,
 		},
+		&cli.StringFlag{
+			Name:        "remote",
+			Value:       "",
+			Usage:       "`NAME` of the git remote identifying the Gitlab project. By default, the remote of the current branch upstream, then origin, then any remote whose host answers as a Gitlab API, are tried",
+			EnvVars:     []string{"GCL_REMOTE"},
+			Destination: &gitRemoteName,
+		},
+		&cli.StringFlag{
+			Name:        "config",
+			Value:       "",
+			Usage:       "`FILE` of user settings (default: $XDG_CONFIG_HOME/gitlab-ci-linter/config.yml, or ~/.config/gitlab-ci-linter/config.yml). Project settings are read from the .gitlab-ci-linter.yml file at the root of the repository",
+			EnvVars:     []string{"GCL_CONFIG"},
+			Destination: &userConfigPath,
+		},
 		&cli.Int64Flag{
 			Name:        "timeout",
 			Aliases:     []string{"t"},
@@ -224,6 +258,71 @@ Usage:
 			EnvVars:     []string{"GCL_TIMEOUT"},
 			Destination: &httpRequestTimeout,
 		},
+		&cli.IntFlag{
+			Name:        "concurrency",
+			Aliases:     []string{"j"},
+			Value:       checkConcurrency,
+			Usage:       "maximum `NUMBER` of gitlab-ci files checked at the same time",
+			EnvVars:     []string{"GCL_CONCURRENCY"},
+			Destination: &checkConcurrency,
+		},
+		&cli.Int64Flag{
+			Name:        "retry-max-attempts",
+			Value:       retryMaxAttempts,
+			Usage:       "maximum number of attempts of a request to Gitlab API failing with a connection error or a transient status (429, 502, 503, 504). 1 disables the retries",
+			EnvVars:     []string{"GCL_RETRY_MAX_ATTEMPTS"},
+			Destination: &retryMaxAttempts,
+		},
+		&cli.DurationFlag{
+			Name:        "retry-delay",
+			Value:       retryDelay,
+			Usage:       "`DURATION` before the first retry of a request to Gitlab API, doubled at each retry (with a random jitter), unless the API asks for a delay with the Retry-After or RateLimit-Reset headers",
+			EnvVars:     []string{"GCL_RETRY_DELAY"},
+			Destination: &retryDelay,
+		},
+		&cli.DurationFlag{
+			Name:        "retry-max-delay",
+			Value:       retryMaxDelay,
+			Usage:       "maximum `DURATION` before a retry of a request to Gitlab API. The request is not retried if the API asks for a longer delay",
+			EnvVars:     []string{"GCL_RETRY_MAX_DELAY"},
+			Destination: &retryMaxDelay,
+		},
+		&cli.StringFlag{
+			Name:        "ca-file",
+			Usage:       "PEM `FILE` of certificate authorities to trust to connect to Gitlab API, in addition to the system ones",
+			EnvVars:     []string{"GCL_CA_FILE"},
+			Destination: &tlsCAFile,
+		},
+		&cli.StringFlag{
+			Name:        "ca-path",
+			Usage:       "`DIR` of PEM files of certificate authorities to trust to connect to Gitlab API, in addition to the system ones",
+			EnvVars:     []string{"GCL_CA_PATH"},
+			Destination: &tlsCAPath,
+		},
+		&cli.StringFlag{
+			Name:        "client-cert",
+			Usage:       "PEM `FILE` of the client certificate to connect to Gitlab API (mutual TLS), possibly including its key",
+			EnvVars:     []string{"GCL_CLIENT_CERT"},
+			Destination: &tlsClientCert,
+		},
+		&cli.StringFlag{
+			Name:        "client-key",
+			Usage:       "PEM `FILE` of the key of the client certificate, if not included in the --client-cert file",
+			EnvVars:     []string{"GCL_CLIENT_KEY"},
+			Destination: &tlsClientKey,
+		},
+		&cli.StringFlag{
+			Name:        "tls-min-version",
+			Usage:       "minimum TLS `VERSION` to connect to Gitlab API: 1.0, 1.1, 1.2 or 1.3 (default: 1.2)",
+			EnvVars:     []string{"GCL_TLS_MIN_VERSION"},
+			Destination: &tlsMinVersion,
+		},
+		&cli.BoolFlag{
+			Name:        "insecure-skip-verify",
+			Usage:       "DANGEROUS: don't verify the certificate of Gitlab API, allowing the connection (and the token) to be intercepted. Prefer --ca-file or --ca-path",
+			EnvVars:     []string{"GCL_INSECURE_SKIP_VERIFY"},
+			Destination: &tlsInsecureSkipVerify,
+		},
 		&cli.BoolFlag{
 			Name:    "no-color",
 			Usage:   "don't color output. By defaults the output is colorized if a compatible terminal is detected.",
@@ -243,6 +342,69 @@ Usage:
 			EnvVars:     []string{"GCL_INCLUDE_MERGED_YAML"},
 			Destination: &includeMergedYaml,
 		},
+		&cli.StringFlag{
+			Name:        "merged-yaml-output",
+			Usage:       "write the merged yaml returned by the Gitlab API in `FILE`. Use \"-\" for stdout, then nothing else is written on stdout",
+			EnvVars:     []string{"GCL_MERGED_YAML_OUTPUT"},
+			Destination: &mergedYamlOutput,
+		},
+		&cli.StringFlag{
+			Name:        "merged-yaml-format",
+			Value:       mergedYamlFormatYAML,
+			Usage:       fmt.Sprintf("`FORMAT` of the merged yaml written with --merged-yaml-output: \"%s\" or \"%s\"", mergedYamlFormatYAML, mergedYamlFormatJSON),
+			EnvVars:     []string{"GCL_MERGED_YAML_FORMAT"},
+			Destination: &mergedYamlFormat,
+		},
+		&cli.BoolFlag{
+			Name:        "merged-yaml-strip-hidden",
+			Usage:       "remove hidden keys (e.g. \".template\" jobs) from the merged yaml written with --merged-yaml-output",
+			EnvVars:     []string{"GCL_MERGED_YAML_STRIP_HIDDEN"},
+			Destination: &mergedYamlStripHidden,
+		},
+		&cli.BoolFlag{
+			Name:        "inline-local-includes",
+			Value:       inlineLocalIncludes,
+			Usage:       "inline the content of the local includes, read from the working tree, in the content sent to the API. Else they are read by Gitlab from the remote ref",
+			EnvVars:     []string{"GCL_INLINE_LOCAL_INCLUDES"},
+			Destination: &inlineLocalIncludes,
+		},
+		&cli.BoolFlag{
+			Name:        "recursive",
+			Aliases:     []string{"r"},
+			Usage:       "check all the gitlab-ci files found in the directories (given as PATH, or --directory) and their sub directories, except the ones ignored by git",
+			EnvVars:     []string{"GCL_RECURSIVE"},
+			Destination: &recursiveMode,
+		},
+		&cli.StringSliceFlag{
+			Name:    "recursive-pattern",
+			Value:   cli.NewStringSlice(recursiveCiFilePatterns...),
+			Usage:   "patterns of the gitlab-ci files searched with --recursive, relative to the searched directory ('**/' matching any directories)",
+			EnvVars: []string{"GCL_RECURSIVE_PATTERNS"},
+		},
+		&cli.StringFlag{
+			Name:        "fragment-policy",
+			Value:       fragmentPolicy,
+			Usage:       "with --recursive, how to check the found files that are locally included by another found file: 'skip' (only checked as part of the including file), 'wrap' (checked through a generated file including it) or 'lint' (checked as a standalone file)",
+			EnvVars:     []string{"GCL_FRAGMENT_POLICY"},
+			Destination: &fragmentPolicy,
+		},
+		&cli.StringFlag{
+			Name:        "remote-ref",
+			Usage:       "validate the CI configuration stored at `REF` (branch, tag or commit) of the Gitlab project, instead of local files",
+			EnvVars:     []string{"GCL_REMOTE_REF"},
+			Destination: &remoteRef,
+		},
+		&cli.BoolFlag{
+			Name:        "staged",
+			Usage:       "check the version of the files staged in the git index, instead of the working tree. Enabled by default when running as a git pre-commit hook",
+			EnvVars:     []string{"GCL_STAGED"},
+			Destination: &stagedMode,
+		},
+		&cli.StringSliceFlag{
+			Name:    "hook-trigger-pattern",
+			Usage:   "when running as a git pre-commit hook, also check if a staged file matches one of these patterns (relative to the repository root, '**' matching any directories). Else the check is only done if the gitlab-ci file or one of its local includes is staged",
+			EnvVars: []string{"GCL_HOOK_TRIGGER_PATTERNS"},
+		},
 		&cli.BoolFlag{
 			Name:        "dry-run",
 			Aliases:     []string{"s"},
@@ -256,6 +418,37 @@ Usage:
 			EnvVars:     []string{"GCL_DRY_RUN_REF"},
 			Destination: &dryRunRef,
 		},
+		&cli.BoolFlag{
+			Name:        "fail-on-warnings",
+			Usage:       "fail, with exit code 11, when the Gitlab API returns warnings for a valid gitlab-ci file",
+			EnvVars:     []string{"GCL_FAIL_ON_WARNINGS"},
+			Destination: &failOnWarnings,
+		},
+		&cli.StringFlag{
+			Name:        "format",
+			Value:       outputFormatText,
+			Usage:       fmt.Sprintf("output `FORMAT` of the check results: \"%s\" (colorized human readable) or \"%s\" (one JSON document per checked file, on stdout)", outputFormatText, outputFormatJSON),
+			EnvVars:     []string{"GCL_FORMAT"},
+			Destination: &outputFormat,
+		},
+		&cli.StringFlag{
+			Name:        "junit-report",
+			Usage:       "write a JUnit XML report of the check results in `FILE`, e.g. to be used as a Gitlab CI junit artifact report",
+			EnvVars:     []string{"GCL_JUNIT_REPORT"},
+			Destination: &junitReportFile,
+		},
+		&cli.StringFlag{
+			Name:        "codequality-report",
+			Usage:       "write a Gitlab Code Quality (CodeClimate JSON) report of the lint errors and warnings in `FILE`",
+			EnvVars:     []string{"GCL_CODEQUALITY_REPORT"},
+			Destination: &codeQualityReportFile,
+		},
+		&cli.StringFlag{
+			Name:        "sarif-report",
+			Usage:       "write a SARIF 2.1.0 log of the lint errors and warnings in `FILE`",
+			EnvVars:     []string{"GCL_SARIF_REPORT"},
+			Destination: &sarifReportFile,
+		},
 	}
 	cli.VersionFlag = &cli.BoolFlag{
 		Name:  "version, V",
@@ -268,8 +461,8 @@ Usage:
 			Aliases:     []string{"c"},
 			Usage:       "Check the .gitlab-ci.yml (default command if none is given)",
 			Action:      commandCheck,
-			ArgsUsage:   "[PATH]",
-			Description: pathArgumentDescription,
+			ArgsUsage:   "[PATH...]",
+			Description: checkPathArgumentDescription,
 		},
 		{
 			Name:        "install",
@@ -304,6 +497,11 @@ Usage:
 			color.NoColor = true
 		}
 
+		// Without explicit directory, the work tree given to git is used
+		if workTree := os.Getenv(gitWorkTreeEnv); workTree != "" && !c.IsSet("directory") {
+			directoryRoot = workTree
+		}
+
 		// Check if the given directory path exists
 		if directoryRoot != "" {
 			directoryRoot, _ = filepath.Abs(directoryRoot)
@@ -340,6 +538,82 @@ Usage:
 			gitlabRootURL = u.String()
 		}
 
+		outputFormat = strings.ToLower(strings.TrimSpace(outputFormat))
+		if !isValidOutputFormat(outputFormat) {
+			return cli.Exit(fmt.Sprintf("Unknown output format '%s'", outputFormat), 1)
+		}
+		if outputFormat != outputFormatText {
+			messageOutput = color.Error
+		}
+
+		mergedYamlFormat = strings.ToLower(strings.TrimSpace(mergedYamlFormat))
+		if mergedYamlFormat != mergedYamlFormatYAML && mergedYamlFormat != mergedYamlFormatJSON {
+			return cli.Exit(fmt.Sprintf("Unknown merged yaml format '%s'", mergedYamlFormat), 1)
+		}
+		if mergedYamlOutput == "-" {
+			if outputFormat != outputFormatText {
+				return cli.Exit(fmt.Sprintf("Merged yaml can't be written on stdout with the '%s' output format", outputFormat), 1)
+			}
+			textOutput = color.Error
+			messageOutput = color.Error
+		}
+
+		gitlabCiFilePatterns = c.StringSlice("ci-file-pattern")
+		hookTriggerPatterns = c.StringSlice("hook-trigger-pattern")
+		recursiveCiFilePatterns = c.StringSlice("recursive-pattern")
+
+		fragmentPolicy = strings.ToLower(strings.TrimSpace(fragmentPolicy))
+		if !isValidFragmentPolicy(fragmentPolicy) {
+			return cli.Exit(fmt.Sprintf("Unknown fragment policy '%s'", fragmentPolicy), 1)
+		}
+
+		if remoteRef = strings.TrimSpace(remoteRef); remoteRef != "" {
+			if recursiveMode {
+				return cli.Exit("--remote-ref can't be given with --recursive", 1)
+			}
+			if stagedMode {
+				return cli.Exit("--remote-ref can't be given with --staged", 1)
+			}
+		} else if !c.IsSet("staged") && isRunningAsGitHook() {
+			stagedMode = true
+		}
+
+		if userConfigPath = strings.TrimSpace(userConfigPath); userConfigPath != "" {
+			if expanded, err := homedir.Expand(userConfigPath); err == nil {
+				userConfigPath = expanded
+			}
+			userConfigPath, _ = filepath.Abs(userConfigPath)
+		}
+
+		if checkConcurrency < 1 {
+			return cli.Exit(fmt.Sprintf("Invalid concurrency '%d', it must be at least 1", checkConcurrency), 1)
+		}
+
+		if retryMaxAttempts < 1 {
+			return cli.Exit(fmt.Sprintf("Invalid maximum number of attempts '%d', it must be at least 1", retryMaxAttempts), 1)
+		}
+		if retryDelay < 0 || retryMaxDelay < 0 {
+			return cli.Exit("Retry delays can't be negative", 1)
+		}
+
+		if tlsMinVersion = strings.TrimSpace(tlsMinVersion); tlsMinVersion != "" {
+			version, ok := normalizeTLSVersion(tlsMinVersion)
+			if !ok {
+				return cli.Exit(fmt.Sprintf("Unsupported TLS version '%s'", tlsMinVersion), 1)
+			}
+			tlsMinVersion = version
+		}
+		for _, path := range []*string{&tlsCAFile, &tlsCAPath, &tlsClientCert, &tlsClientKey} {
+			if *path = strings.TrimSpace(*path); *path != "" {
+				*path, _ = filepath.Abs(*path)
+			}
+		}
+		// The key can't be paired with the client certificate of the config file
+		if tlsClientKey != "" && tlsClientCert == "" {
+			return cli.Exit("--client-key can't be given without --client-cert", 1)
+		}
+
+		gitRemoteName = strings.TrimSpace(gitRemoteName)
 		projectPath = strings.TrimSpace(projectPath)
 		projectID = strings.TrimSpace(projectID)
 
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the merged yaml output
+const (
+	mergedYamlFormatYAML = "yaml"
+	mergedYamlFormatJSON = "json"
+)
+
+// Path of the file where to write the merged yaml, "-" for stdout
+var mergedYamlOutput string
+
+// Format used to write the merged yaml
+var mergedYamlFormat = mergedYamlFormatYAML
+
+// Tells if hidden keys (hidden jobs, templates...) are removed from the written merged yaml
+var mergedYamlStripHidden = false
+
+// Removes the hidden keys (starting with a dot, like hidden jobs or templates) of a mapping node
+func stripHiddenYamlKeys(mapping *yaml.Node) {
+	content := make([]*yaml.Node, 0, len(mapping.Content))
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if strings.HasPrefix(mapping.Content[i].Value, ".") {
+			continue
+		}
+		content = append(content, mapping.Content[i], mapping.Content[i+1])
+	}
+	mapping.Content = content
+}
+
+// Converts a value decoded from YAML to a value that can be encoded in JSON, as YAML mappings keys may not be strings
+func jsonCompatibleValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = jsonCompatibleValue(item)
+		}
+		return v
+	case map[any]any:
+		converted := make(map[string]any, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = jsonCompatibleValue(item)
+		}
+		return converted
+	case []any:
+		for i, item := range v {
+			v[i] = jsonCompatibleValue(item)
+		}
+		return v
+	}
+	return value
+}
+
+// Serializes the merged yaml returned by the Gitlab API in the given format, with a normalized indentation
+func formatMergedYaml(mergedYaml string, format string, stripHidden bool) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(mergedYaml), &document); err != nil {
+		return nil, fmt.Errorf("unable to parse merged yaml: %w", err)
+	}
+
+	if stripHidden && len(document.Content) > 0 && document.Content[0].Kind == yaml.MappingNode {
+		stripHiddenYamlKeys(document.Content[0])
+	}
+
+	var buf bytes.Buffer
+	if format == mergedYamlFormatJSON {
+		var value any
+		if err := document.Decode(&value); err != nil {
+			return nil, fmt.Errorf("unable to decode merged yaml: %w", err)
+		}
+		encoder := json.NewEncoder(&buf)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(jsonCompatibleValue(value)); err != nil {
+			return nil, fmt.Errorf("unable to encode merged yaml as JSON: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return nil, fmt.Errorf("unable to encode merged yaml: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("unable to encode merged yaml: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Writes the merged yaml returned by the Gitlab API for each checked file in the file given by --merged-yaml-output,
+// or on stdout
+// When several files were checked, their merged yaml are written one after the other, as a multi-document YAML or a
+// stream of JSON documents.
+func writeMergedYaml(results []*CheckResult) error {
+	var buf bytes.Buffer
+	documents := 0
+	for _, result := range results {
+		if result.mergedYaml == "" {
+			continue
+		}
+		content, err := formatMergedYaml(result.mergedYaml, mergedYamlFormat, mergedYamlStripHidden)
+		if err != nil {
+			return fmt.Errorf("%s: %w", result.File, err)
+		}
+		if documents > 0 && mergedYamlFormat == mergedYamlFormatYAML {
+			buf.WriteString("---\n")
+		}
+		buf.Write(content)
+		documents++
+	}
+
+	if documents == 0 {
+		if verboseMode {
+			fmt.Fprintln(messageOutput, "No merged yaml to write")
+		}
+		return nil
+	}
+
+	if mergedYamlOutput == "-" {
+		_, err := os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	err := os.WriteFile(mergedYamlOutput, buf.Bytes(), 0644) // #nosec G306
+	if err != nil {
+		return fmt.Errorf("unable to write merged yaml in '%s': %w", mergedYamlOutput, err)
+	}
+	if verboseMode {
+		fmt.Fprintf(messageOutput, "Merged yaml written in %s\n", mergedYamlOutput)
+	}
+
+	return nil
+}
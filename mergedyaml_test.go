@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+const formatMergedYamlContent = `.template:
+    image: alpine
+build:
+    extends: .template
+    script:
+        - make
+`
+
+func TestFormatMergedYaml(t *testing.T) {
+	content, err := formatMergedYaml(formatMergedYamlContent, mergedYamlFormatYAML, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := ".template:\n  image: alpine\nbuild:\n  extends: .template\n  script:\n    - make\n"
+	if string(content) != expected {
+		t.Errorf("received yaml '%s' while expecting '%s'", content, expected)
+	}
+
+	content, err = formatMergedYaml(formatMergedYamlContent, mergedYamlFormatYAML, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = "build:\n  extends: .template\n  script:\n    - make\n"
+	if string(content) != expected {
+		t.Errorf("received stripped yaml '%s' while expecting '%s'", content, expected)
+	}
+
+	content, err = formatMergedYaml(formatMergedYamlContent, mergedYamlFormatJSON, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = "{\n  \"build\": {\n    \"extends\": \".template\",\n    \"script\": [\n      \"make\"\n    ]\n  }\n}\n"
+	if string(content) != expected {
+		t.Errorf("received json '%s' while expecting '%s'", content, expected)
+	}
+
+	if _, err = formatMergedYaml("a: [", mergedYamlFormatYAML, false); err == nil {
+		t.Errorf("expecting an error for an invalid yaml")
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats supported by the check command
+const (
+	outputFormatText = "text"
+	outputFormatJSON = "json"
+)
+
+// Version of the schema of the structured documents. To be increased on any non backward compatible change.
+const checkResultSchemaVersion = 1
+
+// Stages of a pipeline whose configuration does not declare any, besides .pre and .post
+var defaultPipelineStages = []string{"build", "test", "deploy"}
+
+// Output format of the check results
+var outputFormat = outputFormatText
+
+// Tells if lint warnings make the check fail
+var failOnWarnings = false
+
+// Path of the JUnit XML report file to write, if any
+var junitReportFile string
+
+// Path of the Gitlab Code Quality report file to write, if any
+var codeQualityReportFile string
+
+// Path of the SARIF log file to write, if any
+var sarifReportFile string
+
+// Writer used for the human readable check results.
+// When stdout is used to output the merged yaml, results are sent to stderr.
+var textOutput io.Writer = color.Output
+
+// Writer used for informative and verbose messages.
+// When a machine-readable format is written on stdout, messages are sent to stderr to keep stdout parsable.
+var messageOutput io.Writer = color.Output
+
+// CheckResult struct represents the result of the check of a gitlab-ci file, as exposed in structured outputs
+type CheckResult struct {
+	SchemaVersion int                `json:"schema_version"`
+	File          string             `json:"file"`
+	LintURL       string             `json:"lint_url"`
+	Project       string             `json:"project"`
+	Ref           string             `json:"ref"`
+	Valid         bool               `json:"valid"`
+	Errors        []string           `json:"errors"`
+	Warnings      []string           `json:"warnings"`
+	Messages      []LintMessage      `json:"messages"`
+	Jobs          []GitlabAPILintJob `json:"jobs,omitempty"`
+	MergedYaml    string             `json:"merged_yaml,omitempty"`
+	Error         string             `json:"error,omitempty"`
+	Hint          string             `json:"hint,omitempty"`
+	StartedAt     time.Time          `json:"started_at"`
+	DurationMs    int64              `json:"duration_ms"`
+
+	// Error that prevented the check to complete
+	err error
+	// Merged yaml returned by the API, whether it is exposed in the result or not
+	mergedYaml string
+}
+
+// Creates a new check result for a file, with the timing started
+func newCheckResult(file string) *CheckResult {
+	return &CheckResult{
+		SchemaVersion: checkResultSchemaVersion,
+		File:          file,
+		Errors:        []string{},
+		Warnings:      []string{},
+		Messages:      []LintMessage{},
+		StartedAt:     time.Now(),
+	}
+}
+
+// Stops the timing of a check result
+func (r *CheckResult) finish() {
+	r.DurationMs = time.Since(r.StartedAt).Milliseconds()
+}
+
+// Records the error that prevented a check to complete, with a hint about its cause for a Gitlab API failure
+func (r *CheckResult) setError(err error) {
+	r.err = err
+	r.Error = err.Error()
+
+	var apiErr *GitlabAPIError
+	if errors.As(err, &apiErr) {
+		r.Hint = apiErr.Hint()
+	}
+}
+
+// Fills a check result with a response of the Gitlab lint API
+// An invalid response without any error message gives a generic error message.
+func (r *CheckResult) setLintResponse(response GitlabAPILintResponse) {
+	r.Valid = response.Valid
+	if response.Errors != nil {
+		r.Errors = response.Errors
+	}
+	if response.Warnings != nil {
+		r.Warnings = response.Warnings
+	}
+
+	for _, msg := range r.Errors {
+		r.Messages = append(r.Messages, LintMessage{Severity: lintSeverityError, Message: msg})
+	}
+	if !r.Valid && len(r.Errors) == 0 {
+		r.Messages = append(r.Messages, LintMessage{Severity: lintSeverityError, Message: "invalid configuration"})
+	}
+	for _, msg := range r.Warnings {
+		r.Messages = append(r.Messages, LintMessage{Severity: lintSeverityWarning, Message: msg})
+	}
+	r.Jobs = response.Jobs
+	r.mergedYaml = response.MergedYaml
+	if includeMergedYaml {
+		r.MergedYaml = response.MergedYaml
+	}
+}
+
+// Tells if the given output format is supported
+func isValidOutputFormat(format string) bool {
+	switch format {
+	case outputFormatText, outputFormatJSON:
+		return true
+	}
+	return false
+}
+
+// Writes the status of a check result on stdout, and its lint messages on stderr in a compiler-like style: errors in
+// red, then warnings in yellow. A check that could not complete is displayed with its error.
+func writeTextCheckResult(result *CheckResult) {
+	red := color.New(color.FgRed).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+	green := color.New(color.FgGreen).SprintFunc()
+
+	fmt.Fprintf(textOutput, "Validating %s... ", result.File)
+
+	switch {
+	case result.err != nil:
+		fmt.Fprintf(textOutput, "%s\n", red("ERROR"))
+		fmt.Fprintf(color.Error, "%s\n", red(result.Error))
+		if result.Hint != "" {
+			fmt.Fprintf(color.Error, "%s\n", yellow("Hint: "+result.Hint))
+		}
+		return
+	case !result.Valid:
+		fmt.Fprintf(textOutput, "%s\n", red("KO"))
+	case failOnWarnings && len(result.Warnings) > 0:
+		fmt.Fprintf(textOutput, "%s\n", red("KO (warnings)"))
+	case len(result.Warnings) > 0:
+		fmt.Fprintf(textOutput, "%s\n", yellow("OK (warnings)"))
+	default:
+		fmt.Fprintf(textOutput, "%s\n", green("OK"))
+	}
+
+	for _, msg := range result.Messages {
+		colorize := red
+		if msg.Severity == lintSeverityWarning {
+			colorize = yellow
+		}
+		fmt.Fprintf(color.Error, "%s\n", colorize(msg.compilerStyle(result.File)))
+	}
+
+	if len(result.Jobs) > 0 {
+		writeTextPipelineJobs(result)
+	}
+
+	if result.MergedYaml != "" && mergedYamlOutput == "" {
+		fmt.Fprintf(textOutput, "Merged yaml: %s\n", result.MergedYaml)
+	}
+}
+
+// Writes the jobs of the simulated pipeline of a check result, as a table grouped by stage
+func writeTextPipelineJobs(result *CheckResult) {
+	if result.Ref != "" {
+		fmt.Fprintf(textOutput, "Simulated pipeline on %s:\n", result.Ref)
+	} else {
+		fmt.Fprintf(textOutput, "Simulated pipeline:\n")
+	}
+
+	table := tabwriter.NewWriter(textOutput, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(table, "  STAGE\tJOB\tWHEN\tALLOW FAILURE\tTAGS\n")
+	for _, stageJobs := range groupPipelineJobsByStage(result.Jobs, result.mergedYaml) {
+		for i, job := range stageJobs {
+			// The stage is only given on the first job of each group
+			stage := ""
+			if i == 0 {
+				stage = job.Stage
+			}
+			allowFailure := ""
+			if job.AllowFailure {
+				allowFailure = "yes"
+			}
+			fmt.Fprintf(table, "  %s\t%s\t%s\t%s\t%s\n", stage, job.Name, job.When, allowFailure, strings.Join(job.TagList, ", "))
+		}
+	}
+	_ = table.Flush()
+}
+
+// Returns the jobs of a simulated pipeline grouped by stage, in the order of the stages declared in the merged yaml (or
+// the default stages), then of the first job of each other stage. The jobs keep their order in each stage.
+func groupPipelineJobsByStage(jobs []GitlabAPILintJob, mergedYaml string) [][]GitlabAPILintJob {
+	var document struct {
+		Stages []string `yaml:"stages"`
+	}
+	if err := yaml.Unmarshal([]byte(mergedYaml), &document); err != nil || len(document.Stages) == 0 {
+		document.Stages = defaultPipelineStages
+	}
+	stages := append(append([]string{".pre"}, document.Stages...), ".post")
+
+	stageIndexes := map[string]int{}
+	groups := [][]GitlabAPILintJob{}
+	for _, stage := range stages {
+		if _, found := stageIndexes[stage]; !found {
+			stageIndexes[stage] = len(groups)
+			groups = append(groups, nil)
+		}
+	}
+	for _, job := range jobs {
+		index, found := stageIndexes[job.Stage]
+		if !found {
+			index = len(groups)
+			stageIndexes[job.Stage] = index
+			groups = append(groups, nil)
+		}
+		groups[index] = append(groups[index], job)
+	}
+
+	// Stages without jobs are not displayed
+	nonEmptyGroups := [][]GitlabAPILintJob{}
+	for _, group := range groups {
+		if len(group) > 0 {
+			nonEmptyGroups = append(nonEmptyGroups, group)
+		}
+	}
+	return nonEmptyGroups
+}
+
+// Writes a check result as a single line JSON document
+func writeJSONCheckResult(w io.Writer, result *CheckResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(result); err != nil {
+		return fmt.Errorf("unable to encode JSON result: %w", err)
+	}
+	return nil
+}
+
+// Function writing a report of the given check results
+type reportWriter func(w io.Writer, results []*CheckResult) error
+
+// Writes all the report files that were asked for, with the given check results
+func writeReports(results []*CheckResult) error {
+	reports := []struct {
+		path   string
+		name   string
+		writer reportWriter
+	}{
+		{junitReportFile, "JUnit", writeJUnitReport},
+		{codeQualityReportFile, "Code Quality", writeCodeQualityReport},
+		{sarifReportFile, "SARIF", writeSarifReport},
+	}
+
+	for _, report := range reports {
+		if report.path == "" {
+			continue
+		}
+		if err := writeReportFile(report.path, results, report.writer); err != nil {
+			return fmt.Errorf("unable to write %s report '%s': %w", report.name, report.path, err)
+		}
+		if verboseMode {
+			fmt.Fprintf(messageOutput, "%s report written in %s\n", report.name, report.path)
+		}
+	}
+
+	return nil
+}
+
+// Creates (or truncates) a report file and writes the check results in it
+func writeReportFile(path string, results []*CheckResult, writer reportWriter) error {
+	file, err := os.Create(path) // #nosec G304
+	if err != nil {
+		return err
+	}
+
+	err = writer(file, results)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSONCheckResult(t *testing.T) {
+	result := newCheckResult(".gitlab-ci.yml")
+	result.LintURL = "https://gitlab.com/api/v4/projects/my%2Fproject/ci/lint"
+	result.Project = "my/project"
+	result.Ref = "main"
+	result.setLintResponse(GitlabAPILintResponse{
+		Valid:  false,
+		Errors: []string{"jobs:build:script config should be an array"},
+	})
+	result.finish()
+
+	var buf bytes.Buffer
+	if err := writeJSONCheckResult(&buf, result); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("expecting a single line JSON document, received '%s'", buf.String())
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("unable to decode JSON document: %s", err)
+	}
+	for _, key := range []string{"schema_version", "file", "lint_url", "project", "ref", "valid", "errors", "warnings", "started_at", "duration_ms"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("key '%s' missing from JSON document", key)
+		}
+	}
+	if warnings, ok := decoded["warnings"].([]any); !ok || len(warnings) != 0 {
+		t.Errorf("expecting an empty warnings list, received %v", decoded["warnings"])
+	}
+	if decoded["lint_url"] != result.LintURL {
+		t.Errorf("received lint_url '%v' while expecting '%s'", decoded["lint_url"], result.LintURL)
+	}
+}
+
+func TestWriteTextPipelineJobs(t *testing.T) {
+	result := newCheckResult(".gitlab-ci.yml")
+	result.setLintResponse(GitlabAPILintResponse{
+		Valid:      true,
+		MergedYaml: "stages:\n- build\n- test\n- deploy\n",
+		Jobs: []GitlabAPILintJob{
+			{Name: "unit", Stage: "test", When: "on_success"},
+			{Name: "compile", Stage: "build", When: "on_success"},
+			{Name: "lint", Stage: "test", When: "on_success"},
+			{Name: "release", Stage: "deploy", When: "manual"},
+			{Name: "assets", Stage: "build", When: "on_success"},
+			{Name: "setup", Stage: ".pre", When: "on_success"},
+		},
+	})
+
+	var buf bytes.Buffer
+	defer func(w io.Writer) { textOutput = w }(textOutput)
+	textOutput = &buf
+	writeTextPipelineJobs(result)
+
+	expected := [][]string{
+		{".pre", "setup"},
+		{"build", "compile"},
+		{"assets"},
+		{"test", "unit"},
+		{"lint"},
+		{"deploy", "release"},
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(expected)+2 {
+		t.Fatalf("received %d lines while expecting %d: %s", len(lines), len(expected)+2, buf.String())
+	}
+	for i, fields := range expected {
+		received := strings.Fields(lines[i+2])
+		if len(received) < len(fields) || strings.Join(received[:len(fields)], " ") != strings.Join(fields, " ") {
+			t.Errorf("line %d: received '%s' while expecting it to start with '%s'", i+2, lines[i+2], strings.Join(fields, " "))
+		}
+	}
+}
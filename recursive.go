@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Tells if the check searches all the gitlab-ci files down the directory hierarchy, instead of a single one up
+var recursiveMode = false
+
+// Patterns of the gitlab-ci files searched in recursive mode, relative to the searched directory
+var recursiveCiFilePatterns = []string{"**/.gitlab-ci.yml", "**/.gitlab-ci.yaml", "**/*.gitlab-ci.yml", "**/*.gitlab-ci.yaml"}
+
+// Policies for the fragments found in recursive mode: files included by another found file
+const (
+	fragmentPolicySkip = "skip"
+	fragmentPolicyWrap = "wrap"
+	fragmentPolicyLint = "lint"
+)
+
+// Policy for the fragments found in recursive mode
+// Skipped fragments are only validated as part of the files including them, wrapped ones are validated through a
+// generated file including them, and the other ones are validated as standalone files.
+var fragmentPolicy = fragmentPolicySkip
+
+// Content validated for a wrapped fragment: it includes the fragment, with a placeholder job in the .pre stage so that a
+// fragment defining only hidden jobs or templates is valid, whatever its stages
+const fragmentWrapperTemplate = `include:
+  - local: %s
+
+gitlab-ci-linter-fragment:
+  stage: .pre
+  script:
+    - "true"
+`
+
+// Tells if the given fragment policy is supported
+func isValidFragmentPolicy(policy string) bool {
+	switch policy {
+	case fragmentPolicySkip, fragmentPolicyWrap, fragmentPolicyLint:
+		return true
+	}
+	return false
+}
+
+// Returns the content validated for a wrapped fragment, given its path relative to the repository root
+func fragmentWrapperContent(relativePath string) []byte {
+	return []byte(fmt.Sprintf(fragmentWrapperTemplate, "/"+relativePath))
+}
+
+// Searches all the gitlab-ci files matching recursiveCiFilePatterns in a directory and its sub directories, skipping
+// the files ignored by git. Returns the files to check, according to the fragment policy.
+func findGitlabCiFilesRecursively(directory string) ([]ciFileTarget, error) {
+	patterns := make([]*regexp.Regexp, 0, len(recursiveCiFilePatterns))
+	for _, pattern := range recursiveCiFilePatterns {
+		re, err := includeGlobToRegexp(strings.TrimPrefix(pattern, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid gitlab-ci file pattern '%s': %w", pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+
+	workTree := directory
+	gitRepoPath, err := findGitRepo(directory)
+	if err != nil {
+		gitRepoPath = ""
+	} else if repoWorkTree := gitWorkTree(gitRepoPath); repoWorkTree != "" {
+		workTree = repoWorkTree
+	}
+	files := []string{}
+	err = walkGitWorkTree(workTree, gitRepoPath, directory, func(path string, _ string) error {
+		relativePath, _ := filepath.Rel(directory, path)
+		relativePath = filepath.ToSlash(relativePath)
+		for _, re := range patterns {
+			if re.MatchString(relativePath) {
+				files = append(files, path)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return applyFragmentPolicy(files), nil
+}
+
+// Applies the fragment policy to found gitlab-ci files: the files that are locally included by another one are
+// skipped or wrapped. Returns the files to check.
+func applyFragmentPolicy(files []string) []ciFileTarget {
+	if fragmentPolicy == fragmentPolicyLint {
+		checked := make([]ciFileTarget, 0, len(files))
+		for _, file := range files {
+			checked = append(checked, ciFileTarget{path: file})
+		}
+		return checked
+	}
+
+	fragments := map[string]bool{}
+	for _, file := range files {
+		gitRepoPath := findGitRepoOfFile(file)
+		if gitRepoPath == "" {
+			continue
+		}
+		content, repoFiles, err := readGitlabCiFile(file, gitRepoPath)
+		if err != nil || repoFiles == nil {
+			continue
+		}
+		_, included, err := inlineGitlabCiLocalIncludes(content, repoFiles)
+		if err != nil {
+			continue
+		}
+		for _, includedFile := range included {
+			fragments[filepath.Join(gitWorkTree(gitRepoPath), filepath.FromSlash(includedFile.path))] = true
+		}
+	}
+
+	checked := make([]ciFileTarget, 0, len(files))
+	for _, file := range files {
+		switch {
+		case !fragments[file]:
+			checked = append(checked, ciFileTarget{path: file})
+		case fragmentPolicy == fragmentPolicyWrap:
+			checked = append(checked, ciFileTarget{path: file, wrap: true})
+		case verboseMode:
+			fmt.Fprintf(messageOutput, "%s is included by another gitlab-ci file, skipped\n", displayFilePath(file))
+		}
+	}
+
+	return checked
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindGitlabCiFilesRecursively(t *testing.T) {
+	root := t.TempDir()
+	excludesFile := filepath.Join(t.TempDir(), "ignore")
+	createTestFiles(t, filepath.Dir(excludesFile), map[string]string{"ignore": "generated.gitlab-ci.yml\n"})
+	createTestFiles(t, root, map[string]string{
+		".git/config":                    "[core]\n\texcludesFile = " + filepath.ToSlash(excludesFile) + "\n",
+		".git/info/exclude":              "tmp/\n",
+		".gitignore":                     "build/\n",
+		"ci/generated.gitlab-ci.yml":     "generated:\n  script: echo\n",
+		"tmp/.gitlab-ci.yml":             "tmp:\n  script: echo\n",
+		"vendor/lib/.git":                "gitdir: ../../.git/modules/lib\n",
+		"vendor/lib/.gitlab-ci.yml":      "lib:\n  script: echo\n",
+		".gitlab-ci.yml":                 "include: /ci/common.gitlab-ci.yml\n",
+		"ci/common.gitlab-ci.yml":        ".base:\n  script: echo\n",
+		"services/api/.gitlab-ci.yml":    "api:\n  script: echo\n",
+		"services/api/deploy.yml":        "deploy:\n  script: echo\n",
+		"services/web/.gitlab-ci.yaml":   "web:\n  script: echo\n",
+		"services/web/.gitignore":        "*.gitlab-ci.yml\n",
+		"services/web/old.gitlab-ci.yml": "old:\n  script: echo\n",
+		"build/generated/.gitlab-ci.yml": "generated:\n  script: echo\n",
+	})
+
+	data := []struct {
+		policy   string
+		expected string
+	}{
+		{fragmentPolicySkip, ".gitlab-ci.yml,services/api/.gitlab-ci.yml,services/web/.gitlab-ci.yaml"},
+		{fragmentPolicyWrap, ".gitlab-ci.yml,ci/common.gitlab-ci.yml,services/api/.gitlab-ci.yml,services/web/.gitlab-ci.yaml"},
+		{fragmentPolicyLint, ".gitlab-ci.yml,ci/common.gitlab-ci.yml,services/api/.gitlab-ci.yml,services/web/.gitlab-ci.yaml"},
+	}
+	defer func(policy string) { fragmentPolicy = policy }(fragmentPolicy)
+	for _, testData := range data {
+		t.Run("policy="+testData.policy, func(t *testing.T) {
+			fragmentPolicy = testData.policy
+
+			found, err := findGitlabCiFilesRecursively(root)
+			if err != nil {
+				t.Fatalf("received error '%s' while expecting none", err)
+			}
+			relativePaths := []string{}
+			wrapped := map[string]bool{}
+			for _, file := range found {
+				relativePath, _ := filepath.Rel(root, file.path)
+				relativePaths = append(relativePaths, filepath.ToSlash(relativePath))
+				wrapped[file.path] = file.wrap
+			}
+			if received := strings.Join(relativePaths, ","); received != testData.expected {
+				t.Errorf("received files '%s' while expecting '%s'", received, testData.expected)
+			}
+
+			fragment := filepath.Join(root, "ci", "common.gitlab-ci.yml")
+			if wrapped[fragment] != (testData.policy == fragmentPolicyWrap) {
+				t.Errorf("received wrapped %v for the fragment with the '%s' policy", wrapped[fragment], testData.policy)
+			}
+		})
+	}
+}
+
+func TestCheckWrappedFragmentWithoutRepository(t *testing.T) {
+	root := t.TempDir()
+	createTestFiles(t, root, map[string]string{"common.gitlab-ci.yml": ".base:\n  script: echo\n"})
+
+	result := checkGitlabCiFile(ciFileTarget{path: filepath.Join(root, "common.gitlab-ci.yml"), wrap: true})
+	if !strings.Contains(result.Error, "not in the work tree of a git repository") {
+		t.Errorf("received error '%s' while expecting a missing work tree error", result.Error)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Ref (branch, tag or commit) of the Gitlab project whose stored CI configuration is validated, instead of local files
+var remoteRef = ""
+
+// Validates the CI configuration stored at a ref of the Gitlab project, without any local file
+// The project is resolved as for local files, from the repository of the --ci-file, else of the --directory.
+func checkGitlabCiRemoteRef(ref string) *CheckResult {
+	gitRepoPath := ""
+	if gitlabCiFilePath != "" {
+		gitRepoPath = findGitRepoOfFile(gitlabCiFilePath)
+	} else if repoPath, err := findGitRepo(directoryRoot); err == nil {
+		gitRepoPath = repoPath
+	}
+
+	ciConfigPath := getCachedProjectCiConfigPath(gitRepoPath)
+	if ciConfigPath == "" {
+		ciConfigPath = gitlabCiFilePatterns[0]
+	}
+	result := newCheckResult(fmt.Sprintf("%s@%s", ciConfigPath, ref))
+	defer result.finish()
+	result.Ref = ref
+
+	lintURL, project, err := getCachedGitlabLintURL(gitRepoPath)
+	if err != nil {
+		result.setError(err)
+		return result
+	}
+	result.LintURL = lintURL
+	result.Project = project
+
+	if verboseMode {
+		fmt.Fprintf(messageOutput, "Validating the CI configuration of %s at '%s' using %s...\n", project, ref, lintURL)
+	}
+	response, err := lintGitlabCIRemoteRefUsingAPI(lintURL, ref)
+	if err != nil {
+		result.setError(fmt.Errorf("error linting using Gitlab API %s: %w", lintURL, err))
+		return result
+	}
+	result.setLintResponse(response)
+
+	return result
+}
+
+// Returns the URL of the Gitlab lint API validating the CI configuration stored at a ref of the project, given the lint
+// API URL of the project
+// On dry run, the pipeline is simulated for the --dry-run-ref if given, else for the ref itself.
+func gitlabRemoteRefLintURL(lintURL string, ref string) (string, error) {
+	u, err := url.Parse(lintURL)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("content_ref", ref)
+	if dryRun {
+		dryRunRef := dryRunRef
+		if dryRunRef == "" {
+			dryRunRef = ref
+		}
+		query.Set("dry_run", strconv.FormatBool(dryRun))
+		query.Set("dry_run_ref", dryRunRef)
+		query.Set("include_jobs", strconv.FormatBool(dryRun))
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
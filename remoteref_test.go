@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckGitlabCiRemoteRef(t *testing.T) {
+	var query map[string][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.EscapedPath() == "/api/v4/projects/team%2Fapp":
+			_, _ = w.Write([]byte(`{"id":1,"path_with_namespace":"team/app","ci_config_path":"ci/pipeline.yml"}`))
+		case r.URL.EscapedPath() == "/api/v4/projects/team%2Fapp/ci/lint" && r.Method == "GET":
+			query = r.URL.Query()
+			_, _ = w.Write([]byte(`{"valid":false,"errors":["jobs:build config should implement a script"],"warnings":[],"merged_yaml":"build: {}"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	defer func(rootURL, path, root string, dry bool) {
+		gitlabRootURL, projectPath, directoryRoot, dryRun = rootURL, path, root, dry
+	}(gitlabRootURL, projectPath, directoryRoot, dryRun)
+	gitlabRootURL, projectPath, directoryRoot = server.URL, "team/app", t.TempDir()
+	t.Setenv(gitDirEnv, "")
+	lintTargets = map[string]*lintTarget{}
+	defer func() { lintTargets = map[string]*lintTarget{} }()
+
+	data := []struct {
+		dryRun   bool
+		expected map[string]string
+	}{
+		{false, map[string]string{"content_ref": "v1.2.0", "dry_run": ""}},
+		{true, map[string]string{"content_ref": "v1.2.0", "dry_run": "true", "dry_run_ref": "v1.2.0", "include_jobs": "true"}},
+	}
+	for _, testData := range data {
+		dryRun = testData.dryRun
+		result := checkGitlabCiRemoteRef("v1.2.0")
+		if result.err != nil {
+			t.Fatalf("received error '%s' while expecting none", result.err)
+		}
+		if result.File != "ci/pipeline.yml@v1.2.0" || result.Ref != "v1.2.0" || result.Project != "team/app" {
+			t.Errorf("received file '%s', ref '%s' and project '%s' while expecting the project CI configuration at the ref", result.File, result.Ref, result.Project)
+		}
+		if result.Valid || len(result.Errors) != 1 || result.mergedYaml != "build: {}" {
+			t.Errorf("received result %+v while expecting the lint response", result)
+		}
+		for name, value := range testData.expected {
+			if received := query[name]; (value == "" && received != nil) || (value != "" && (len(received) != 1 || received[0] != value)) {
+				t.Errorf("received %s=%v while expecting '%s'", name, received, value)
+			}
+		}
+	}
+}
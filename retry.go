@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Maximum number of attempts of a request to the Gitlab API, when it fails transiently. 1 disables the retries.
+var retryMaxAttempts int64 = 3
+
+// Delay before the first retry of a request to the Gitlab API, doubled at each following retry
+var retryDelay = 1 * time.Second
+
+// Maximum delay before a retry of a request to the Gitlab API. A longer delay asked by the API is not waited for.
+var retryMaxDelay = 30 * time.Second
+
+// Waits before retrying a request, replaceable by tests
+var retrySleep = time.Sleep
+
+// HTTP statuses of the transient failures of the Gitlab API
+var retryableHTTPStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Sends a request to the Gitlab API with the retry policy: a transient request error or failure status is retried
+// up to retryMaxAttempts times, after an exponential backoff with jitter, or the delay asked by the Retry-After or
+// RateLimit-Reset headers of the response. The response of the last attempt is returned.
+func doGitlabRequest(httpClient *http.Client, req *http.Request) (*http.Response, error) {
+	for attempt := int64(1); ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := httpClient.Do(req)
+		if attempt >= retryMaxAttempts {
+			return resp, err
+		}
+
+		var reason string
+		delay := retryBackoffDelay(attempt)
+		switch {
+		case err != nil:
+			if !isRetryableError(err) {
+				return resp, err
+			}
+			reason = err.Error()
+		case isRetryableStatus(resp.StatusCode):
+			reason = "status " + resp.Status
+			if askedDelay, found := retryAfterDelay(resp.Header, time.Now()); found {
+				if askedDelay > retryMaxDelay {
+					return resp, nil
+				}
+				delay = askedDelay
+			}
+		default:
+			return resp, nil
+		}
+
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if verboseMode {
+			fmt.Fprintf(messageOutput, "Request to %s failed (%s), retrying in %s (attempt %d/%d)...\n",
+				req.URL.Redacted(), reason, delay.Round(time.Millisecond), attempt+1, retryMaxAttempts)
+		}
+		retrySleep(delay)
+	}
+}
+
+// Tells if a failure status of the Gitlab API is transient
+func isRetryableStatus(status int) bool {
+	for _, retryableStatus := range retryableHTTPStatuses {
+		if status == retryableStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// Tells if a request error is transient: a timeout, a connection reset, or a connection closed before the response
+// Other errors (unknown hosts, refused connections, invalid certificates or URLs...) would fail again.
+func isRetryableError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// Returns the delay before a retry following the given attempt: the retry delay doubled at each attempt, up to the
+// maximum delay, with a random jitter of up to its half
+func retryBackoffDelay(attempt int64) time.Duration {
+	delay := retryDelay
+	for i := int64(1); i < attempt && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	// #nosec G404 -- the jitter does not need a secure random source
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Returns the delay before a retry asked by a response, and tells if there is one
+// Retry-After is a number of seconds or an HTTP date, RateLimit-Reset a number of seconds or a Unix timestamp (as sent
+// by Gitlab).
+func retryAfterDelay(header http.Header, now time.Time) (time.Duration, bool) {
+	if value := strings.TrimSpace(header.Get("Retry-After")); value != "" {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return max(date.Sub(now), 0), true
+		}
+	}
+
+	if value := strings.TrimSpace(header.Get("RateLimit-Reset")); value != "" {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+			// Values larger than a year of seconds are timestamps
+			if seconds > 365*24*60*60 {
+				return max(time.Unix(seconds, 0).Sub(now), 0), true
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterDelay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	data := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		found    bool
+	}{
+		{"Retry-After", "7", 7 * time.Second, true},
+		{"Retry-After", "Mon, 01 Jan 2024 12:00:10 GMT", 10 * time.Second, true},
+		{"Retry-After", "Mon, 01 Jan 2024 11:00:00 GMT", 0, true},
+		{"Retry-After", "soon", 0, false},
+		{"RateLimit-Reset", "30", 30 * time.Second, true},
+		{"RateLimit-Reset", "1704110460", time.Minute, true},
+		{"X-Other", "5", 0, false},
+	}
+	for _, testData := range data {
+		header := http.Header{}
+		header.Set(testData.name, testData.value)
+		delay, found := retryAfterDelay(header, now)
+		if delay != testData.expected || found != testData.found {
+			t.Errorf("received %s, %v for %s '%s' while expecting %s, %v", delay, found, testData.name, testData.value, testData.expected, testData.found)
+		}
+	}
+}
+
+func TestRetryBackoffDelay(t *testing.T) {
+	defer func(delay, maxDelay time.Duration) { retryDelay, retryMaxDelay = delay, maxDelay }(retryDelay, retryMaxDelay)
+	retryDelay, retryMaxDelay = time.Second, 5*time.Second
+
+	for attempt, expected := range map[int64]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if delay := retryBackoffDelay(attempt); delay < expected/2 || delay > expected {
+			t.Errorf("received delay %s for attempt %d while expecting between %s and %s", delay, attempt, expected/2, expected)
+		}
+	}
+}
+
+func TestDoGitlabRequest(t *testing.T) {
+	defer func(attempts int64, sleep func(time.Duration)) { retryMaxAttempts, retrySleep = attempts, sleep }(retryMaxAttempts, retrySleep)
+	var delays []time.Duration
+	retrySleep = func(delay time.Duration) { delays = append(delays, delay) }
+
+	var statuses []int
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		status := statuses[0]
+		statuses = statuses[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "3")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	data := []struct {
+		maxAttempts    int64
+		statuses       []int
+		expectedStatus int
+		expectedCalls  int
+	}{
+		{3, []int{503, 429, 200}, 200, 3},
+		{3, []int{502, 502, 502}, 502, 3},
+		{3, []int{404}, 404, 1},
+		{1, []int{503}, 503, 1},
+	}
+	for _, testData := range data {
+		retryMaxAttempts = testData.maxAttempts
+		statuses, bodies, delays = testData.statuses, nil, nil
+
+		req, _ := http.NewRequest("POST", server.URL, strings.NewReader("content"))
+		resp, err := doGitlabRequest(server.Client(), req)
+		if err != nil {
+			t.Fatalf("received error '%s' while expecting none", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != testData.expectedStatus || len(bodies) != testData.expectedCalls {
+			t.Errorf("received status %d after %d calls while expecting %d after %d calls", resp.StatusCode, len(bodies), testData.expectedStatus, testData.expectedCalls)
+		}
+		for _, body := range bodies {
+			if body != "content" {
+				t.Errorf("received body '%s' while expecting the request body at each attempt", body)
+			}
+		}
+		if len(delays) != testData.expectedCalls-1 {
+			t.Errorf("received %d waits while expecting %d", len(delays), testData.expectedCalls-1)
+		}
+	}
+
+	// The delay asked by a 429 response is honoured
+	retryMaxAttempts = 2
+	statuses, delays = []int{429, 200}, nil
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	if resp, err := doGitlabRequest(server.Client(), req); err == nil {
+		resp.Body.Close()
+	}
+	if len(delays) != 1 || delays[0] != 3*time.Second {
+		t.Errorf("received waits %v while expecting the 3s asked by Retry-After", delays)
+	}
+}
+
+func TestGitlabAPIProbesAreRetried(t *testing.T) {
+	defer func(attempts int64, sleep func(time.Duration)) { retryMaxAttempts, retrySleep = attempts, sleep }(retryMaxAttempts, retrySleep)
+	retryMaxAttempts = 3
+	retrySleep = func(time.Duration) {}
+
+	failures := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Each endpoint fails transiently once
+		if failures[r.URL.Path] == 0 {
+			failures[r.URL.Path]++
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": 42, "ci_config_path": "ci/main.yml"}`))
+	}))
+	defer server.Close()
+
+	if !isGitlabAPIRoot(server.URL + "/gitlab") {
+		t.Errorf("the version API probe should be retried")
+	}
+	project, err := getGitlabProject(server.URL + "/api/v4/projects/42")
+	if err != nil || project.CiConfigPath != "ci/main.yml" {
+		t.Errorf("received project %+v and error '%v' while expecting the project query to be retried", project, err)
+	}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	// A closed port refuses the connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedURL := "http://" + listener.Addr().String()
+	listener.Close()
+	_, refusedErr := http.Get(closedURL)
+
+	_, invalidURLErr := http.Get("unsupported://gitlab.example.com")
+
+	// A server closing the connection without answering
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer server.Close()
+	_, eofErr := http.Get(server.URL)
+
+	// A server answering too late
+	slowServer := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slowServer.Close()
+	_, timeoutErr := (&http.Client{Timeout: 10 * time.Millisecond}).Get(slowServer.URL)
+
+	data := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"refused", refusedErr, false},
+		{"invalid url", invalidURLErr, false},
+		{"not found host", &net.DNSError{Err: "no such host", IsNotFound: true}, false},
+		{"eof", eofErr, true},
+		{"timeout", timeoutErr, true},
+		{"reset", &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+	}
+	for _, testData := range data {
+		t.Run(testData.name, func(t *testing.T) {
+			if testData.err == nil {
+				t.Fatalf("received no error while expecting one")
+			}
+			if retryable := isRetryableError(testData.err); retryable != testData.retryable {
+				t.Errorf("received retryable %v for '%s' while expecting %v", retryable, testData.err, testData.retryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+
+	"gitlab.com/orobardet/gitlab-ci-linter/config"
+)
+
+// Version and schema of the SARIF format that is written
+const sarifVersion = "2.1.0"
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// URL of the project, used as tool information in SARIF logs
+const projectInformationURI = "https://gitlab.com/orobardet/gitlab-ci-linter"
+
+// Levels of SARIF results
+const (
+	sarifLevelError   = "error"
+	sarifLevelWarning = "warning"
+)
+
+// A category of lint messages, used to derive SARIF rules
+type lintMessageCategory struct {
+	id          string
+	description string
+	pattern     *regexp.Regexp
+}
+
+// Known categories of lint messages returned by the Gitlab API
+// The first category whose pattern matches a message is used. The last one, without pattern, matches any message.
+var lintMessageCategories = []lintMessageCategory{
+	{"include", "Invalid include", regexp.MustCompile(`(?i)\binclud(e|ed)\b|local file .* does not exist|project file .* does not exist`)},
+	{"yaml-syntax", "Invalid YAML syntax", regexp.MustCompile(`(?i)\(<unknown>\)|yaml syntax|did not find expected|could not find expected|mapping values are not allowed|found character that cannot start any token`)},
+	{"stage", "Unknown stage", regexp.MustCompile(`(?i)chosen stage|stage .*does not exist`)},
+	{"needs", "Invalid job dependency", regexp.MustCompile(`(?i)\bneeds?\b|\bdependenc(y|ies)\b`)},
+	{"multiple-pipelines", "Multiple pipelines for a single action", regexp.MustCompile(`(?i)may allow multiple pipelines`)},
+	{"unknown-keys", "Unknown configuration keys", regexp.MustCompile(`(?i)contains unknown keys?`)},
+	{"missing-keys", "Missing required configuration keys", regexp.MustCompile(`(?i)missing required keys?|should implement`)},
+	{"invalid-value", "Invalid configuration value", regexp.MustCompile(`(?i)\bshould (be|contain|use)\b|can't be blank|has to be|must be|is not (a|an|allowed|valid)`)},
+	{"other", "Invalid CI configuration", nil},
+}
+
+// SarifLog struct represents the root object of a SARIF log
+type SarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SarifRun `json:"runs"`
+}
+
+// SarifRun struct represents a run of the tool in a SARIF log
+type SarifRun struct {
+	Tool        SarifTool         `json:"tool"`
+	Invocations []SarifInvocation `json:"invocations"`
+	Results     []SarifResult     `json:"results"`
+}
+
+// SarifTool struct represents the tool information of a SARIF run
+type SarifTool struct {
+	Driver SarifDriver `json:"driver"`
+}
+
+// SarifDriver struct represents the tool component of a SARIF run
+type SarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []SarifRule `json:"rules"`
+}
+
+// SarifRule struct represents a rule of a SARIF tool component
+type SarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription SarifMessage `json:"shortDescription"`
+}
+
+// SarifInvocation struct represents an invocation of the tool in a SARIF run
+type SarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []SarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+// SarifNotification struct represents an error that prevented the check of a file
+type SarifNotification struct {
+	Level     string          `json:"level"`
+	Message   SarifMessage    `json:"message"`
+	Locations []SarifLocation `json:"locations,omitempty"`
+}
+
+// SarifResult struct represents a lint error or warning in a SARIF run
+type SarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   SarifMessage    `json:"message"`
+	Locations []SarifLocation `json:"locations"`
+}
+
+// SarifMessage struct represents a SARIF message
+type SarifMessage struct {
+	Text string `json:"text"`
+}
+
+// SarifLocation struct represents a location in a SARIF log
+type SarifLocation struct {
+	PhysicalLocation SarifPhysicalLocation `json:"physicalLocation"`
+}
+
+// SarifPhysicalLocation struct represents a location in a file
+type SarifPhysicalLocation struct {
+	ArtifactLocation SarifArtifactLocation `json:"artifactLocation"`
+	Region           *SarifRegion          `json:"region,omitempty"`
+}
+
+// SarifArtifactLocation struct represents the location of a file
+type SarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// SarifRegion struct represents a region in a file
+type SarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// Returns the index, in lintMessageCategories, of the category of a lint message
+func categorizeLintMessage(msg string) int {
+	for i, category := range lintMessageCategories {
+		if category.pattern == nil || category.pattern.MatchString(msg) {
+			return i
+		}
+	}
+	return len(lintMessageCategories) - 1
+}
+
+// Creates the SARIF location of a checked file, with the region of the lint message if its position is known
+func newSarifLocation(file string, msg LintMessage) SarifLocation {
+	location := SarifLocation{
+		PhysicalLocation: SarifPhysicalLocation{
+			ArtifactLocation: SarifArtifactLocation{URI: filepath.ToSlash(msg.location(file))},
+		},
+	}
+	if msg.Line > 0 {
+		location.PhysicalLocation.Region = &SarifRegion{StartLine: msg.Line, StartColumn: msg.Column}
+	}
+
+	return location
+}
+
+// Creates the SARIF result of a lint message of a checked file
+func newSarifResult(file string, msg LintMessage) SarifResult {
+	ruleIndex := categorizeLintMessage(msg.Message)
+	level := sarifLevelError
+	if msg.Severity == lintSeverityWarning {
+		level = sarifLevelWarning
+	}
+
+	return SarifResult{
+		RuleID:    lintMessageCategories[ruleIndex].id,
+		RuleIndex: ruleIndex,
+		Level:     level,
+		Message:   SarifMessage{Text: msg.Message},
+		Locations: []SarifLocation{newSarifLocation(file, msg)},
+	}
+}
+
+// Writes a SARIF log of check results, with a single run for all the checked files
+// Checks that could not complete are reported as tool execution notifications.
+func writeSarifReport(w io.Writer, results []*CheckResult) error {
+	driver := SarifDriver{
+		Name:           config.APPNAME,
+		Version:        config.VERSION,
+		InformationURI: projectInformationURI,
+		Rules:          []SarifRule{},
+	}
+	for _, category := range lintMessageCategories {
+		driver.Rules = append(driver.Rules, SarifRule{ID: category.id, ShortDescription: SarifMessage{Text: category.description}})
+	}
+
+	invocation := SarifInvocation{ExecutionSuccessful: true}
+	run := SarifRun{
+		Tool:    SarifTool{Driver: driver},
+		Results: []SarifResult{},
+	}
+
+	for _, result := range results {
+		if result.Error != "" {
+			invocation.ExecutionSuccessful = false
+			invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, SarifNotification{
+				Level:     sarifLevelError,
+				Message:   SarifMessage{Text: result.Error},
+				Locations: []SarifLocation{newSarifLocation(result.File, LintMessage{})},
+			})
+			continue
+		}
+		for _, msg := range result.Messages {
+			run.Results = append(run.Results, newSarifResult(result.File, msg))
+		}
+	}
+	run.Invocations = []SarifInvocation{invocation}
+
+	log := SarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []SarifRun{run},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(log); err != nil {
+		return fmt.Errorf("unable to encode SARIF log: %w", err)
+	}
+
+	return nil
+}
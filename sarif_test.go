@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+var categorizeLintMessageData = [][]string{
+	{"(<unknown>): did not find expected key while parsing a block mapping at line 3 column 1", "yaml-syntax"},
+	{"Local file `ci/build.yml` does not exist!", "include"},
+	{"Included file `ci/build.yml` does not have valid YAML syntax!", "include"},
+	{"jobs:build chosen stage does not exist; available stages are .pre, build, test, .post", "stage"},
+	{"jobs:test job: undefined need: build", "needs"},
+	{"jobs:build may allow multiple pipelines to run for a single action due to `rules:when` clause with no `workflow:rules`", "multiple-pipelines"},
+	{"root config contains unknown keys: foo", "unknown-keys"},
+	{"jobs:build config missing required keys: script", "missing-keys"},
+	{"jobs:build:script config should be an array", "invalid-value"},
+	{"something unexpected happened", "other"},
+}
+
+func TestCategorizeLintMessage(t *testing.T) {
+	for _, testData := range categorizeLintMessageData {
+		msg := testData[0]
+		expectedID := testData[1]
+		t.Run("msg="+msg, func(t *testing.T) {
+			id := lintMessageCategories[categorizeLintMessage(msg)].id
+			if id != expectedID {
+				t.Errorf("received category '%s' while expecting '%s'", id, expectedID)
+			}
+		})
+	}
+}
+
+func TestWriteSarifReport(t *testing.T) {
+	invalid := newCheckResult(".gitlab-ci.yml")
+	invalid.setLintResponse(GitlabAPILintResponse{
+		Errors:   []string{"jobs:build:script config should be an array"},
+		Warnings: []string{"jobs:test may allow multiple pipelines to run for a single action"},
+	})
+	invalid.Messages[0].Line, invalid.Messages[0].Column = 12, 3
+	failed := newCheckResult("ci/failed.yml")
+	failed.setError(errors.New("HTTP request failed with status 401 Unauthorized"))
+
+	var buf bytes.Buffer
+	if err := writeSarifReport(&buf, []*CheckResult{invalid, failed}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var log SarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("unable to decode SARIF log: %s", err)
+	}
+
+	if log.Version != "2.1.0" || log.Schema != sarifSchema {
+		t.Errorf("received version '%s' and schema '%s' while expecting '2.1.0' and '%s'", log.Version, log.Schema, sarifSchema)
+	}
+	if len(log.Runs) != 1 {
+		t.Fatalf("received %d runs while expecting 1", len(log.Runs))
+	}
+	run := log.Runs[0]
+
+	rules := run.Tool.Driver.Rules
+	if len(rules) != len(lintMessageCategories) {
+		t.Fatalf("received %d rules while expecting %d", len(rules), len(lintMessageCategories))
+	}
+
+	if len(run.Results) != 2 {
+		t.Fatalf("received %d results while expecting 2", len(run.Results))
+	}
+	expected := []struct {
+		ruleID string
+		level  string
+		region *SarifRegion
+	}{
+		{"invalid-value", sarifLevelError, &SarifRegion{StartLine: 12, StartColumn: 3}},
+		{"multiple-pipelines", sarifLevelWarning, nil},
+	}
+	for i, exp := range expected {
+		result := run.Results[i]
+		if result.RuleIndex < 0 || result.RuleIndex >= len(rules) || rules[result.RuleIndex].ID != result.RuleID || result.RuleID != exp.ruleID {
+			t.Errorf("result %d: received rule '%s' at index %d while expecting '%s', matching the rules", i, result.RuleID, result.RuleIndex, exp.ruleID)
+		}
+		if result.Level != exp.level {
+			t.Errorf("result %d: received level '%s' while expecting '%s'", i, result.Level, exp.level)
+		}
+		if len(result.Locations) != 1 || result.Locations[0].PhysicalLocation.ArtifactLocation.URI != ".gitlab-ci.yml" {
+			t.Fatalf("result %d: received locations %+v while expecting .gitlab-ci.yml", i, result.Locations)
+		}
+		region := result.Locations[0].PhysicalLocation.Region
+		if (region == nil) != (exp.region == nil) || (region != nil && *region != *exp.region) {
+			t.Errorf("result %d: received region %+v while expecting %+v", i, region, exp.region)
+		}
+	}
+
+	if len(run.Invocations) != 1 {
+		t.Fatalf("received %d invocations while expecting 1", len(run.Invocations))
+	}
+	invocation := run.Invocations[0]
+	if invocation.ExecutionSuccessful {
+		t.Errorf("the invocation should not be successful when a check could not complete")
+	}
+	if len(invocation.ToolExecutionNotifications) != 1 || invocation.ToolExecutionNotifications[0].Message.Text != failed.Error ||
+		invocation.ToolExecutionNotifications[0].Locations[0].PhysicalLocation.ArtifactLocation.URI != "ci/failed.yml" {
+		t.Errorf("received notifications %+v while expecting one for the failed check", invocation.ToolExecutionNotifications)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// Path of the user ssh config file, relative to the home directory
+const sshConfigPath = ".ssh/config"
+
+// Maximum depth of nested Include directives, as for ssh
+const maxSSHConfigIncludeDepth = 16
+
+// Format of a ssh config option line
+var sshConfigOptionRegexp = regexp.MustCompile(`^([^\s=]+)[\s=]+(.*)$`)
+
+// Words of a ssh config option value: quoted, or space separated
+var sshConfigWordRegexp = regexp.MustCompile(`"[^"]*"|[^\s"]+`)
+
+// A Host block of a ssh config file, limited to the used options
+type sshConfigHost struct {
+	// Host patterns, a "!" prefix negating a pattern
+	patterns []string
+	hostName string
+}
+
+// Parses a ssh config file content, and returns its Host blocks in their order of declaration
+// Only the Host, HostName and Include options are supported: Match blocks are ignored, and the options set before the
+// first Host block apply to all hosts. Included files are parsed at the place of the Include directive, relative paths
+// being relative to the ~/.ssh directory.
+func parseSSHConfig(content []byte) []sshConfigHost {
+	parser := &sshConfigParser{hosts: []sshConfigHost{{patterns: []string{"*"}}}}
+	parser.parse(content, 0)
+	return parser.hosts
+}
+
+// Parser of ssh config files, gathering the Host blocks of a file and of the files it includes
+type sshConfigParser struct {
+	hosts   []sshConfigHost
+	inMatch bool
+}
+
+func (parser *sshConfigParser) parse(content []byte, depth int) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Options are "Keyword value" or "Keyword=value", keywords being case-insensitive
+		matches := sshConfigOptionRegexp.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+		keyword, value := strings.ToLower(matches[1]), matches[2]
+
+		switch keyword {
+		case "host":
+			parser.hosts = append(parser.hosts, sshConfigHost{patterns: splitSSHConfigValue(value)})
+			parser.inMatch = false
+		case "match":
+			parser.inMatch = true
+		case "hostname":
+			if current := &parser.hosts[len(parser.hosts)-1]; !parser.inMatch && current.hostName == "" {
+				current.hostName = strings.Trim(value, `"`)
+			}
+		case "include":
+			if parser.inMatch || depth >= maxSSHConfigIncludeDepth {
+				continue
+			}
+			for _, pattern := range splitSSHConfigValue(value) {
+				for _, file := range sshConfigIncludeFiles(pattern) {
+					if included, err := os.ReadFile(file); err == nil { // #nosec G304
+						parser.parse(included, depth+1)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Returns the files matching the pattern of a ssh config Include directive, in lexical order
+func sshConfigIncludeFiles(pattern string) []string {
+	pattern, err := homedir.Expand(pattern)
+	if err != nil {
+		return nil
+	}
+	if !filepath.IsAbs(pattern) {
+		home, err := homedir.Dir()
+		if err != nil {
+			return nil
+		}
+		pattern = filepath.Join(home, filepath.FromSlash(path.Dir(sshConfigPath)), pattern)
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil
+	}
+	return files
+}
+
+// Splits the value of a ssh config option in its space separated words, that can be quoted
+func splitSSHConfigValue(value string) []string {
+	words := []string{}
+	for _, match := range sshConfigWordRegexp.FindAllString(value, -1) {
+		words = append(words, strings.Trim(match, `"`))
+	}
+	return words
+}
+
+// Tells if a host matches the patterns of a ssh config Host block: one of its patterns, and none of its negated ones
+func (host sshConfigHost) matches(name string) bool {
+	matched := false
+	for _, pattern := range host.patterns {
+		negated := strings.HasPrefix(pattern, "!")
+		if !matchSSHConfigPattern(strings.TrimPrefix(pattern, "!"), name) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// Tells if a host matches a ssh config pattern, where "*" matches any characters and "?" exactly one, ignoring case
+func matchSSHConfigPattern(pattern string, name string) bool {
+	pattern, name = strings.ToLower(pattern), strings.ToLower(name)
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			pattern = strings.TrimLeft(pattern, "*")
+			if pattern == "" {
+				return true
+			}
+			for i := range len(name) {
+				if matchSSHConfigPattern(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+		default:
+			if name == "" || name[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return name == ""
+}
+
+// Returns the real hostname of a ssh host alias, from the HostName option of the user ssh config file
+// As for ssh, the first HostName of the matching Host blocks is used, with "%h" replaced by the alias. The alias itself
+// is returned if no HostName applies, or if the ssh config file can not be read.
+func resolveSSHHostAlias(alias string) string {
+	home, err := homedir.Dir()
+	if err != nil {
+		return alias
+	}
+	content, err := os.ReadFile(filepath.Join(home, filepath.FromSlash(sshConfigPath))) // #nosec G304
+	if err != nil {
+		return alias
+	}
+
+	for _, host := range parseSSHConfig(content) {
+		if host.hostName != "" && host.matches(alias) {
+			return strings.ReplaceAll(strings.ReplaceAll(host.hostName, "%h", alias), "%%", "%")
+		}
+	}
+	return alias
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveSSHHostAlias(t *testing.T) {
+	home := t.TempDir()
+	setTestHomeDir(t, home)
+	createTestFiles(t, home, map[string]string{
+		".ssh/config": "# Gitlab aliases\n" +
+			"Include config.d/*\n" +
+			"Host gl gitlab\n  HostName gitlab.example.com\n  Port 2222\n" +
+			"Host ci-?\n  HostName ci.example.com\n" +
+			"Host=*.corp !secret.corp\n\tHostName=%h.example.com\n" +
+			"Match host gl\n  HostName ignored.example.com\n" +
+			"Host gl\n  HostName shadowed.example.com\n" +
+			"Host \"quoted\"\n  HOSTNAME \"quoted.example.com\"\n" +
+			"Match host matched\n  Include ~/.ssh/matched\n",
+		".ssh/config.d/work": "Host work\n  HostName work.example.com\n",
+		".ssh/matched":       "Host matched\n  HostName matched.example.com\n",
+	})
+
+	tests := map[string]string{
+		"gl":          "gitlab.example.com",
+		"gitlab":      "gitlab.example.com",
+		"GL":          "gitlab.example.com",
+		"forge.corp":  "forge.corp.example.com",
+		"secret.corp": "secret.corp",
+		"quoted":      "quoted.example.com",
+		"gitlab.com":  "gitlab.com",
+		"ci-1":        "ci.example.com",
+		"ci-12":       "ci-12",
+		"work":        "work.example.com",
+		"matched":     "matched",
+	}
+	for alias, expected := range tests {
+		if host := resolveSSHHostAlias(alias); host != expected {
+			t.Errorf("received host '%s' for '%s' while expecting '%s'", host, alias, expected)
+		}
+	}
+
+	remotes := [][]string{
+		{"gl:team/app.git", "https://gitlab.example.com", "team/app"},
+		{"git@gl:team/app", "https://gitlab.example.com", "team/app"},
+		{"ssh://git@gitlab.corp:2222/team/app.git", "https://gitlab.corp.example.com", "team/app"},
+		{"ssh://gl/team/app.git/", "https://gitlab.example.com", "team/app"},
+		{"git+ssh://git@gitlab.com/team/app.git", "https://gitlab.com", "team/app"},
+		{"ssh://git@gitlab.com/~team/app.git", "https://gitlab.com", "team/app"},
+		{"git@gitlab.com:~team/app.git", "https://gitlab.com", "team/app"},
+		{"ssh://git@[::1]:2222/team/app.git", "https://[::1]", "team/app"},
+		{"https://gitlab.com:8443/team/app.git", "https://gitlab.com:8443", "team/app"},
+	}
+	for _, remote := range remotes {
+		root, path := parseGitRemoteURL(remote[0])
+		if root != remote[1] || path != remote[2] {
+			t.Errorf("received '%s', '%s' for '%s' while expecting '%s', '%s'", root, path, remote[0], remote[1], remote[2])
+		}
+	}
+
+	// Without ssh config, the alias is kept
+	setTestHomeDir(t, filepath.Join(home, "nowhere"))
+	if host := resolveSSHHostAlias("gl"); host != "gl" {
+		t.Errorf("received host '%s' while expecting the alias without ssh config", host)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/mitchellh/go-homedir"
+)
+
+// TLS settings of the connections to the Gitlab API, given as parameters. They have precedence over the ones of the
+// user config file hosts.
+var (
+	// PEM file of the certificate authorities to trust, in addition to the system ones
+	tlsCAFile = ""
+	// Directory of PEM files of the certificate authorities to trust, in addition to the system ones
+	tlsCAPath = ""
+	// PEM file of the client certificate, possibly with its key
+	tlsClientCert = ""
+	// PEM file of the client certificate key, if not in the client certificate file
+	tlsClientKey = ""
+	// Minimum TLS version: 1.0, 1.1, 1.2 or 1.3
+	tlsMinVersion = ""
+	// Tells if the certificate of the Gitlab instance is not verified
+	tlsInsecureSkipVerify = false
+)
+
+// TLS versions, by their name in the settings
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsSettings struct represents the TLS settings of the connections to a Gitlab host
+type tlsSettings struct {
+	CAFile     string `yaml:"ca-file,omitempty"`
+	CAPath     string `yaml:"ca-path,omitempty"`
+	ClientCert string `yaml:"client-cert,omitempty"`
+	ClientKey  string `yaml:"client-key,omitempty"`
+	MinVersion string `yaml:"tls-min-version,omitempty"`
+	// Not set unless explicitly given, so that a host settings can disable it again
+	InsecureSkipVerify *bool `yaml:"insecure-skip-verify,omitempty"`
+}
+
+// Hosts settings of the user config file applying to the connections to the Gitlab API, loaded once
+var tlsHostsOnce sync.Once
+var tlsHosts []hostConfig
+var tlsHostsErr error
+
+// Hosts for which the disabled certificate verification was already warned about
+var tlsInsecureWarnedHosts sync.Map
+
+// Normalizes the name of a TLS version ("1.2", "TLS1.2", "tls 1.2"...), and tells if it is supported
+func normalizeTLSVersion(version string) (string, bool) {
+	version = strings.TrimSpace(strings.TrimPrefix(strings.ToLower(strings.TrimSpace(version)), "tls"))
+	_, ok := tlsVersions[version]
+	return version, ok
+}
+
+// Makes the relative paths of TLS settings relative to the given directory, and expands "~" in them
+func (settings *tlsSettings) resolvePaths(directory string) {
+	for _, path := range []*string{&settings.CAFile, &settings.CAPath, &settings.ClientCert, &settings.ClientKey} {
+		if *path == "" {
+			continue
+		}
+		if expanded, err := homedir.Expand(*path); err == nil {
+			*path = expanded
+		}
+		if !filepath.IsAbs(*path) {
+			*path = filepath.Join(directory, *path)
+		}
+	}
+}
+
+// Returns the hosts settings applying to the connections to the Gitlab API: the ones of the user config file, as TLS
+// settings are not allowed in project config files. They are the same whatever the checked repository.
+func getTLSHosts() ([]hostConfig, error) {
+	tlsHostsOnce.Do(func() {
+		cfgs, err := loadConfigFiles("")
+		tlsHosts, tlsHostsErr = configHosts(cfgs), err
+	})
+
+	return tlsHosts, tlsHostsErr
+}
+
+// Returns the TLS settings of the connections to a host: the ones given as parameters, else the ones of the first
+// matching hosts of the config files setting them
+func resolveTLSSettings(hosts []hostConfig, hostName string) tlsSettings {
+	settings := tlsSettings{
+		CAFile:     tlsCAFile,
+		CAPath:     tlsCAPath,
+		ClientCert: tlsClientCert,
+		ClientKey:  tlsClientKey,
+		MinVersion: tlsMinVersion,
+	}
+	if tlsInsecureSkipVerify {
+		settings.InsecureSkipVerify = &tlsInsecureSkipVerify
+	}
+
+	u := &url.URL{Host: hostName}
+	for _, host := range hosts {
+		matched, _ := host.match(u.Host)
+		if !matched && u.Port() != "" {
+			matched, _ = host.match(u.Hostname())
+		}
+		if !matched {
+			continue
+		}
+		if settings.CAFile == "" {
+			settings.CAFile = host.CAFile
+		}
+		if settings.CAPath == "" {
+			settings.CAPath = host.CAPath
+		}
+		// The client certificate and its key go together: a key is never given without its certificate
+		if settings.ClientCert == "" {
+			settings.ClientCert, settings.ClientKey = host.ClientCert, host.ClientKey
+		}
+		if settings.MinVersion == "" {
+			settings.MinVersion = host.MinVersion
+		}
+		if settings.InsecureSkipVerify == nil {
+			settings.InsecureSkipVerify = host.InsecureSkipVerify
+		}
+	}
+
+	return settings
+}
+
+// Builds the TLS configuration of the connections to a host from its TLS settings
+// Returns nil if the default configuration applies.
+func newTLSConfig(settings tlsSettings, hostName string) (*tls.Config, error) {
+	if settings == (tlsSettings{}) {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12} // #nosec G402 -- may be lowered by --tls-min-version
+
+	if settings.MinVersion != "" {
+		version, ok := normalizeTLSVersion(settings.MinVersion)
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version '%s'", settings.MinVersion)
+		}
+		tlsConfig.MinVersion = tlsVersions[version]
+	}
+
+	if settings.CAFile != "" || settings.CAPath != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if settings.CAFile != "" {
+			content, err := os.ReadFile(settings.CAFile) // #nosec G304
+			if err != nil {
+				return nil, fmt.Errorf("unable to read CA file: %w", err)
+			}
+			if !pool.AppendCertsFromPEM(content) {
+				return nil, fmt.Errorf("no PEM certificate found in CA file '%s'", settings.CAFile)
+			}
+		}
+		if settings.CAPath != "" {
+			entries, err := os.ReadDir(settings.CAPath)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read CA path: %w", err)
+			}
+			for _, entry := range entries {
+				if entry.IsDir() {
+					continue
+				}
+				// Only the PEM certificates are added, the other files are skipped
+				if content, err := os.ReadFile(filepath.Join(settings.CAPath, entry.Name())); err == nil { // #nosec G304
+					pool.AppendCertsFromPEM(content)
+				}
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if settings.ClientCert != "" {
+		keyFile := settings.ClientKey
+		if keyFile == "" {
+			keyFile = settings.ClientCert
+		}
+		certificate, err := tls.LoadX509KeyPair(settings.ClientCert, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	} else if settings.ClientKey != "" {
+		return nil, errors.New("a client key is given without client certificate")
+	}
+
+	if settings.InsecureSkipVerify != nil && *settings.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true // #nosec G402 -- explicitly asked, and loudly warned
+		if _, warned := tlsInsecureWarnedHosts.LoadOrStore(hostName, true); !warned {
+			red := color.New(color.FgRed, color.Bold).SprintFunc()
+			fmt.Fprintln(messageOutput, red(fmt.Sprintf("WARNING: TLS certificate verification is disabled for %s, the connection is NOT secure "+
+				"and the token can be intercepted. Use --ca-file or --ca-path instead of --insecure-skip-verify.", hostName)))
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// Returns the TLS configuration of the connections to the Gitlab API at the given URL
+// Returns nil if the default configuration applies.
+func gitlabTLSConfig(gitlabURL string) (*tls.Config, error) {
+	u, err := url.Parse(gitlabURL)
+	if err != nil || u.Scheme != "https" {
+		return nil, nil
+	}
+	hosts, err := getTLSHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	return newTLSConfig(resolveTLSSettings(hosts, u.Host), u.Host)
+}
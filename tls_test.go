@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates a self-signed client certificate, and writes it with its key in PEM files
+func createTestClientCertificate(t *testing.T, directory string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gitlab-ci-linter"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+
+	createTestFiles(t, directory, map[string]string{
+		"client.crt": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		"client.key": string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})),
+		// Certificate with its key
+		"client.pem": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})) +
+			string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})),
+	})
+	return certificate
+}
+
+func TestGitlabTLSSettings(t *testing.T) {
+	root := t.TempDir()
+	clientCertificate := createTestClientCertificate(t, filepath.Join(root, "certs"))
+
+	// Gitlab instance with its own certificate authority, requiring a client certificate
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCertificate)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MaxVersion: tls.VersionTLS12}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	createTestFiles(t, root, map[string]string{
+		"certs/ca/gitlab.pem": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+		"certs/ca/README":     "not a certificate",
+	})
+	serverURL, _ := url.Parse(server.URL)
+
+	createTestFiles(t, root, map[string]string{
+		"config.yml": "hosts:\n" +
+			"  - host: " + serverURL.Host + "\n    ca-path: certs/ca\n    client-cert: certs/client.crt\n    client-key: certs/client.key\n" +
+			"  - host-regexp: '^127\\.'\n    ca-path: /nowhere\n    tls-min-version: TLS1.1\n",
+		"insecure.yml": "hosts:\n  - host-regexp: '.*'\n    insecure-skip-verify: true\n    client-cert: certs/client.pem\n",
+		// A more specific entry disables the insecure mode again
+		"secure.yml": "hosts:\n  - host: " + serverURL.Host + "\n    insecure-skip-verify: false\n" +
+			"  - host-regexp: '.*'\n    insecure-skip-verify: true\n    client-cert: certs/client.pem\n",
+		"invalid.yml":  "hosts:\n  - host: gitlab.com\n    tls-min-version: '2.0'\n",
+		"key-only.yml": "hosts:\n  - host: gitlab.com\n    client-key: certs/client.key\n",
+	})
+	if _, err := readConfigFile(filepath.Join(root, "invalid.yml"), true); err == nil || !strings.Contains(err.Error(), "unsupported TLS version") {
+		t.Errorf("received error '%v' while expecting an unsupported TLS version", err)
+	}
+	if _, err := readConfigFile(filepath.Join(root, "key-only.yml"), true); err == nil || !strings.Contains(err.Error(), "without client-cert") {
+		t.Errorf("received error '%v' while expecting a client key without certificate to be rejected", err)
+	}
+
+	var messages bytes.Buffer
+	defer func(output io.Writer) { messageOutput = output }(messageOutput)
+	messageOutput = &messages
+
+	data := []struct {
+		config      string
+		minVersion  string
+		expectedErr string
+	}{
+		{"", "", "certificate"},
+		{"config.yml", "", ""},
+		{"config.yml", "1.3", "version"},
+		{"insecure.yml", "", ""},
+		{"secure.yml", "", "certificate"},
+	}
+	for _, testData := range data {
+		var hosts []hostConfig
+		if testData.config != "" {
+			cfg, err := readConfigFile(filepath.Join(root, testData.config), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hosts = cfg.Hosts
+		}
+		tlsMinVersion = testData.minVersion
+
+		tlsConfig, err := newTLSConfig(resolveTLSSettings(hosts, serverURL.Host), serverURL.Host)
+		if err != nil {
+			t.Fatalf("received error '%s' for %s while expecting none", err, testData.config)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		switch {
+		case testData.expectedErr == "" && err != nil:
+			t.Errorf("received error '%s' for %s while expecting none", err, testData.config)
+		case testData.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), testData.expectedErr)):
+			t.Errorf("received error '%v' for %s while expecting '%s'", err, testData.config, testData.expectedErr)
+		}
+	}
+	tlsMinVersion = ""
+
+	if !strings.Contains(messages.String(), "WARNING: TLS certificate verification is disabled for "+serverURL.Host) {
+		t.Errorf("received messages '%s' while expecting a warning about the disabled certificate verification", messages.String())
+	}
+
+	// Parameters have precedence over the hosts settings
+	defer func(caFile string) { tlsCAFile = caFile }(tlsCAFile)
+	tlsCAFile = filepath.Join(root, "nowhere.pem")
+	cfg, _ := readConfigFile(filepath.Join(root, "config.yml"), true)
+	settings := resolveTLSSettings(cfg.Hosts, serverURL.Host)
+	if settings.CAFile != tlsCAFile || settings.MinVersion != "1.1" || settings.ClientCert != filepath.Join(root, "certs", "client.crt") {
+		t.Errorf("received settings %+v while expecting the CA file parameter, then the settings of the matching hosts", settings)
+	}
+	if _, err := newTLSConfig(settings, serverURL.Host); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("received error '%v' while expecting the missing CA file", err)
+	}
+
+	// TLS settings are not allowed in the project config files
+	setTestHomeDir(t, filepath.Join(root, "home"))
+	t.Setenv(gitDirEnv, "")
+	t.Setenv(gitWorkTreeEnv, "")
+	createTestFiles(t, root, map[string]string{
+		"repo/.git/config":           "",
+		"repo/.gitlab-ci-linter.yml": "hosts:\n  - host-regexp: '.*'\n    insecure-skip-verify: true\n",
+	})
+	if _, err := loadConfigFiles(filepath.Join(root, "repo", ".git")); err == nil || !strings.Contains(err.Error(), "only allowed in the user config file") {
+		t.Errorf("received error '%v' while expecting TLS settings to be rejected in a project config file", err)
+	}
+}